@@ -0,0 +1,219 @@
+"use client";
+
+import * as React from "react";
+import { useAdmin } from "../../hooks/use-admin";
+import { Account, StartAccountOAuthResponse } from "../../types/admin";
+import {
+  Table,
+  TableBody,
+  TableCell,
+  TableHead,
+  TableHeader,
+  TableRow,
+} from "../ui/table";
+import { Badge } from "../ui/badge";
+import { Card, CardContent, CardDescription, CardHeader, CardTitle } from "../ui/card";
+import { Check, ExternalLink, Plus, RefreshCw } from "lucide-react";
+import { Button } from "../ui/button";
+import { Input } from "../ui/input";
+
+function GroupEditor({ account }: { account: Account }) {
+  const { updateAccountGroup } = useAdmin();
+  const [group, setGroup] = React.useState(account.group || "");
+  const [saving, setSaving] = React.useState(false);
+
+  React.useEffect(() => {
+    setGroup(account.group || "");
+  }, [account.group]);
+
+  const handleSave = async () => {
+    setSaving(true);
+    try {
+      await updateAccountGroup(account.email, group.trim());
+    } catch (_e) {
+      // Error handled by hook
+    } finally {
+      setSaving(false);
+    }
+  };
+
+  return (
+    <div className="flex items-center gap-2">
+      <Input
+        placeholder="Shared pool"
+        value={group}
+        onChange={(e) => setGroup(e.target.value)}
+        className="h-9 w-[180px] bg-white text-sm"
+      />
+      <Button
+        variant="ghost"
+        size="icon"
+        onClick={handleSave}
+        loading={saving}
+        disabled={group.trim() === (account.group || "")}
+        className="h-9 w-9 shrink-0 text-zinc-500 hover:text-zinc-900 hover:bg-zinc-100"
+      >
+        <Check className="h-4 w-4" />
+      </Button>
+    </div>
+  );
+}
+
+function AddAccount() {
+  const { startAccountOAuth, completeAccountOAuth, isLoading } = useAdmin();
+  const [login, setLogin] = React.useState<StartAccountOAuthResponse | null>(null);
+  const [callbackUrl, setCallbackUrl] = React.useState("");
+
+  const handleStart = async () => {
+    try {
+      const res = await startAccountOAuth();
+      if (!res) return;
+      setLogin(res);
+      setCallbackUrl("");
+      window.open(res.auth_url, "_blank", "noopener");
+    } catch (_e) {
+      // Error handled by hook
+    }
+  };
+
+  const handleComplete = async (e: React.FormEvent) => {
+    e.preventDefault();
+    try {
+      await completeAccountOAuth(callbackUrl.trim());
+      setLogin(null);
+      setCallbackUrl("");
+    } catch (_e) {
+      // Error handled by hook
+    }
+  };
+
+  if (!login) {
+    return (
+      <Button onClick={handleStart} className="h-11 px-6 w-full sm:w-auto">
+        <Plus className="mr-2 h-4 w-4" />
+        Add Account
+      </Button>
+    );
+  }
+
+  return (
+    <form onSubmit={handleComplete} className="space-y-3 rounded-xl border border-zinc-200 bg-zinc-50 p-4">
+      <p className="text-sm text-zinc-600">
+        Sign in with the Google account in the window that opened
+        {" "}
+        (<a href={login.auth_url} target="_blank" rel="noopener noreferrer" className="inline-flex items-center gap-1 underline">
+          open again <ExternalLink className="h-3 w-3" />
+        </a>).
+        {" "}
+        The browser is then redirected to <span className="font-mono text-xs">{login.redirect_uri}</span>.
+        If that page does not load, paste its full URL below.
+      </p>
+      <div className="flex flex-col gap-2 sm:flex-row">
+        <Input
+          placeholder={`${login.redirect_uri}?state=...&code=...`}
+          value={callbackUrl}
+          onChange={(e) => setCallbackUrl(e.target.value)}
+          className="h-11 bg-white font-mono text-xs"
+        />
+        <Button
+          type="submit"
+          loading={isLoading}
+          disabled={callbackUrl.trim() === ""}
+          className="h-11 px-6 shrink-0"
+        >
+          Complete
+        </Button>
+        <Button
+          type="button"
+          variant="outline"
+          onClick={() => setLogin(null)}
+          className="h-11 px-6 shrink-0"
+        >
+          Cancel
+        </Button>
+      </div>
+    </form>
+  );
+}
+
+export function AccountList() {
+  const { accounts, refreshAccounts } = useAdmin();
+  const [refreshing, setRefreshing] = React.useState(false);
+
+  const handleRefresh = async () => {
+    setRefreshing(true);
+    try {
+      await refreshAccounts();
+    } finally {
+      setRefreshing(false);
+    }
+  };
+
+  return (
+    <Card className="border-zinc-200 bg-white shadow-sm">
+      <CardHeader className="flex flex-row items-center justify-between pb-4">
+        <div>
+          <CardTitle className="text-lg sm:text-xl font-semibold text-zinc-900">Accounts</CardTitle>
+          <CardDescription className="text-zinc-500 text-sm">
+            Google accounts in the pool and the account groups they serve
+          </CardDescription>
+        </div>
+        <Button
+          variant="outline"
+          size="icon"
+          onClick={handleRefresh}
+          loading={refreshing}
+          className="h-9 w-9 shrink-0 border-zinc-200 hover:bg-zinc-50"
+        >
+          <RefreshCw className="h-4 w-4" />
+        </Button>
+      </CardHeader>
+      <CardContent className="space-y-6 px-4 sm:px-6">
+        {accounts.length === 0 ? (
+          <div className="flex flex-col items-center justify-center gap-2 py-12 text-zinc-400">
+            <div className="text-sm">No accounts found</div>
+            <div className="text-xs">Add a Google account to start serving requests</div>
+          </div>
+        ) : (
+          <div className="overflow-x-auto">
+            <Table>
+              <TableHeader>
+                <TableRow className="hover:bg-transparent border-zinc-200 bg-zinc-50/50">
+                  <TableHead className="pl-4">Email</TableHead>
+                  <TableHead>Project</TableHead>
+                  <TableHead className="w-[240px]">Group</TableHead>
+                </TableRow>
+              </TableHeader>
+              <TableBody>
+                {accounts.map((account) => (
+                  <TableRow key={account.email} className="border-zinc-200 hover:bg-zinc-50/50">
+                    <TableCell className="pl-4 text-zinc-700">{account.email}</TableCell>
+                    <TableCell>
+                      {account.project_id ? (
+                        <Badge
+                          variant="secondary"
+                          className="bg-zinc-100 text-zinc-700 border border-zinc-200 font-mono text-xs"
+                        >
+                          {account.project_id}
+                        </Badge>
+                      ) : (
+                        <span className="text-zinc-400 italic">None</span>
+                      )}
+                    </TableCell>
+                    <TableCell>
+                      <GroupEditor account={account} />
+                    </TableCell>
+                  </TableRow>
+                ))}
+              </TableBody>
+            </Table>
+          </div>
+        )}
+
+        <div className="flex justify-end">
+          <AddAccount />
+        </div>
+      </CardContent>
+    </Card>
+  );
+}
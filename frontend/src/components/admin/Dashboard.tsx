@@ -3,6 +3,7 @@
 import { useAdmin } from "../../hooks/use-admin";
 import { CreateKeyForm } from "./CreateKeyForm";
 import { KeyList } from "./KeyList";
+import { AccountList } from "./AccountList";
 import { Button } from "../ui/button";
 import { LogOut, Key } from "lucide-react";
 
@@ -53,6 +54,7 @@ export function Dashboard() {
           <div className="grid gap-8 lg:gap-10">
             <CreateKeyForm />
             <KeyList />
+            <AccountList />
           </div>
         </div>
       </main>
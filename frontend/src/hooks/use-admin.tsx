@@ -2,7 +2,14 @@
 
 import * as React from "react";
 import { AdminClient } from "../lib/api";
-import { ApiKey, GenerateKeyRequest, UpdateKeyRequest, ModelInfo } from "../types/admin";
+import {
+  Account,
+  ApiKey,
+  GenerateKeyRequest,
+  UpdateKeyRequest,
+  ModelInfo,
+  StartAccountOAuthResponse,
+} from "../types/admin";
 
 interface AdminContextType {
   isAuthenticated: boolean;
@@ -10,6 +17,7 @@ interface AdminContextType {
   error: string | null;
   keys: ApiKey[];
   models: ModelInfo[];
+  accounts: Account[];
   login: (secret: string) => Promise<void>;
   logout: () => void;
   refreshKeys: () => Promise<void>;
@@ -17,6 +25,10 @@ interface AdminContextType {
   createKey: (req: GenerateKeyRequest) => Promise<void>;
   updateKey: (key: string, req: UpdateKeyRequest) => Promise<void>;
   revokeKey: (key: string) => Promise<void>;
+  refreshAccounts: () => Promise<void>;
+  updateAccountGroup: (email: string, group: string) => Promise<void>;
+  startAccountOAuth: () => Promise<StartAccountOAuthResponse | undefined>;
+  completeAccountOAuth: (callbackUrl: string) => Promise<void>;
 }
 
 const AdminContext = React.createContext<AdminContextType | undefined>(
@@ -27,6 +39,7 @@ export function AdminProvider({ children }: { children: React.ReactNode }) {
   const [secret, setSecret] = React.useState<string | null>(null);
   const [keys, setKeys] = React.useState<ApiKey[]>([]);
   const [models, setModels] = React.useState<ModelInfo[]>([]);
+  const [accounts, setAccounts] = React.useState<Account[]>([]);
   const [isLoading, setIsLoading] = React.useState(false);
   const [error, setError] = React.useState<string | null>(null);
 
@@ -78,13 +91,25 @@ export function AdminProvider({ children }: { children: React.ReactNode }) {
     }
   }, [client]);
 
+  const refreshAccounts = React.useCallback(async () => {
+    if (!client) return;
+    try {
+      const res = await client.listAccounts();
+      setAccounts(res.data);
+    } catch (err: unknown) {
+      const errorMessage = err instanceof Error ? err.message : "Unknown error";
+      setError(errorMessage);
+    }
+  }, [client]);
+
   // Initial fetch when secret is set
   React.useEffect(() => {
     if (secret) {
       refreshKeys();
       refreshModels();
+      refreshAccounts();
     }
-  }, [secret, refreshKeys, refreshModels]);
+  }, [secret, refreshKeys, refreshModels, refreshAccounts]);
 
   const login = async (newSecret: string) => {
     setIsLoading(true);
@@ -107,6 +132,7 @@ export function AdminProvider({ children }: { children: React.ReactNode }) {
     setSecret(null);
     setKeys([]);
     setModels([]);
+    setAccounts([]);
     localStorage.removeItem("admin_secret");
   };
 
@@ -158,6 +184,50 @@ export function AdminProvider({ children }: { children: React.ReactNode }) {
     }
   };
 
+  const updateAccountGroup = async (email: string, group: string) => {
+    if (!client) return;
+    setIsLoading(true);
+    setError(null);
+    try {
+      await client.updateAccountGroup(email, group);
+      await refreshAccounts();
+    } catch (err: unknown) {
+      const errorMessage = err instanceof Error ? err.message : "Unknown error";
+      setError(errorMessage);
+      throw err;
+    } finally {
+      setIsLoading(false);
+    }
+  };
+
+  const startAccountOAuth = async () => {
+    if (!client) return;
+    setError(null);
+    try {
+      return await client.startAccountOAuth();
+    } catch (err: unknown) {
+      const errorMessage = err instanceof Error ? err.message : "Unknown error";
+      setError(errorMessage);
+      throw err;
+    }
+  };
+
+  const completeAccountOAuth = async (callbackUrl: string) => {
+    if (!client) return;
+    setIsLoading(true);
+    setError(null);
+    try {
+      await client.completeAccountOAuth(callbackUrl);
+      await refreshAccounts();
+    } catch (err: unknown) {
+      const errorMessage = err instanceof Error ? err.message : "Unknown error";
+      setError(errorMessage);
+      throw err;
+    } finally {
+      setIsLoading(false);
+    }
+  };
+
   return (
     <AdminContext.Provider
       value={{
@@ -166,6 +236,7 @@ export function AdminProvider({ children }: { children: React.ReactNode }) {
         error,
         keys,
         models,
+        accounts,
         login,
         logout,
         refreshKeys,
@@ -173,6 +244,10 @@ export function AdminProvider({ children }: { children: React.ReactNode }) {
         createKey,
         updateKey,
         revokeKey,
+        refreshAccounts,
+        updateAccountGroup,
+        startAccountOAuth,
+        completeAccountOAuth,
       }}
     >
       {children}
@@ -3,9 +3,12 @@ import {
   GenerateKeyResponse,
   ListKeysResponse,
   ListModelsResponse,
+  ListAccountsResponse,
+  StartAccountOAuthResponse,
   UpdateKeyRequest,
   ApiKey,
   ApiError,
+  Account,
 } from "../types/admin";
 
 const API_BASE = ""; // Relative path since we're serving from the same domain or proxy
@@ -69,4 +72,29 @@ export class AdminClient {
   async listModels(): Promise<ListModelsResponse> {
     return this.request<ListModelsResponse>("/admin/models");
   }
+
+  async listAccounts(): Promise<ListAccountsResponse> {
+    return this.request<ListAccountsResponse>("/admin/accounts");
+  }
+
+  async updateAccountGroup(email: string, group: string): Promise<Account> {
+    return this.request<Account>(`/admin/accounts/${encodeURIComponent(email)}`, {
+      method: "PUT",
+      body: JSON.stringify({ group }),
+    });
+  }
+
+  async startAccountOAuth(): Promise<StartAccountOAuthResponse> {
+    return this.request<StartAccountOAuthResponse>(
+      "/admin/accounts/oauth/start",
+      { method: "POST" }
+    );
+  }
+
+  async completeAccountOAuth(callbackUrl: string): Promise<Account> {
+    return this.request<Account>("/admin/accounts/oauth/complete", {
+      method: "POST",
+      body: JSON.stringify({ callback_url: callbackUrl }),
+    });
+  }
 }
\ No newline at end of file
@@ -1,21 +1,51 @@
+export interface SafetyPolicy {
+  thresholds?: Record<string, string>;
+  allow_client_settings?: boolean;
+}
+
 export interface ApiKey {
   key: string;
   created_at: string;
   note?: string;
   rate_limit?: number;
+  token_rate_limit?: number;
   allowed_models?: string[];
+  account_group?: string;
+  shared_fallback?: boolean;
+  priority?: number;
+  response_cache?: boolean;
+  thinking_budget?: number;
+  files_quota?: number;
+  safety?: SafetyPolicy;
 }
 
 export interface GenerateKeyRequest {
   note: string;
   rate_limit: number;
+  token_rate_limit?: number;
   allowed_models?: string[];
+  account_group?: string;
+  shared_fallback?: boolean;
+  priority?: number;
+  response_cache?: boolean;
+  thinking_budget?: number;
+  files_quota?: number;
+  safety?: SafetyPolicy;
 }
 
+// Fields left out keep their current value; null clears an override.
 export interface UpdateKeyRequest {
-  note: string;
-  rate_limit: number;
+  note?: string;
+  rate_limit?: number;
+  token_rate_limit?: number;
   allowed_models?: string[];
+  account_group?: string;
+  shared_fallback?: boolean;
+  priority?: number;
+  response_cache?: boolean | null;
+  thinking_budget?: number | null;
+  files_quota?: number;
+  safety?: SafetyPolicy | null;
 }
 
 export interface GenerateKeyResponse {
@@ -23,7 +53,15 @@ export interface GenerateKeyResponse {
   created_at: string;
   note?: string;
   rate_limit?: number;
+  token_rate_limit?: number;
   allowed_models?: string[];
+  account_group?: string;
+  shared_fallback?: boolean;
+  priority?: number;
+  response_cache?: boolean;
+  thinking_budget?: number;
+  files_quota?: number;
+  safety?: SafetyPolicy;
 }
 
 export interface ListKeysResponse {
@@ -39,6 +77,23 @@ export interface ListModelsResponse {
   data: ModelInfo[];
 }
 
+export interface Account {
+  email: string;
+  project_id?: string;
+  expired?: string;
+  group?: string;
+}
+
+export interface ListAccountsResponse {
+  data: Account[];
+}
+
+export interface StartAccountOAuthResponse {
+  auth_url: string;
+  state: string;
+  redirect_uri: string;
+}
+
 export interface ApiError {
   error: {
     message: string;
@@ -0,0 +1,109 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/anthropics/antigravity-wrapper/internal/auth"
+	"github.com/anthropics/antigravity-wrapper/internal/contextwindow"
+	"github.com/anthropics/antigravity-wrapper/internal/executor"
+	"github.com/anthropics/antigravity-wrapper/internal/models"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// summaryPrompt asks the model to summarize turns dropped from the context.
+const summaryPrompt = "Summarize the conversation above so that it can replace it as context for continuing the conversation. " +
+	"Keep facts, decisions, file names, code identifiers and open tasks. Reply with the summary only."
+
+// summaryMaxTokens bounds the length of generated summaries.
+const summaryMaxTokens = 1024
+
+// fitContextWindow checks the payload against the model's context window and
+// applies the configured strategy. If the request cannot be served, an error
+// response is written and false is returned.
+func (s *Server) fitContextWindow(c *gin.Context, modelName string, payload []byte, creds *auth.Credentials) ([]byte, bool) {
+	limit := models.ContextWindow(modelName)
+	if override, ok := s.cfg.ContextWindows[modelName]; ok {
+		limit = override
+	}
+	if limit <= 0 {
+		return payload, true
+	}
+
+	fitted, err := contextwindow.Fit(c.Request.Context(), payload, limit, contextwindow.Options{
+		Strategy: s.contextStrategy,
+		Count: func(ctx context.Context, payload []byte) int {
+			return int(s.countInputTokens(ctx, creds, modelName, payload))
+		},
+		Summarize: s.contextSummarizer(modelName, creds),
+	})
+	if err != nil {
+		var exceeded *contextwindow.ExceededError
+		if errors.As(err, &exceeded) {
+			log.Warnf("Request for %s exceeds context window: %v", modelName, err)
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": gin.H{
+					"message": err.Error(),
+					"type":    "invalid_request_error",
+					"code":    "context_length_exceeded",
+				},
+			})
+			return nil, false
+		}
+		log.Errorf("Context window check failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": gin.H{
+				"message": err.Error(),
+				"type":    "api_error",
+			},
+		})
+		return nil, false
+	}
+	return fitted, true
+}
+
+// contextSummarizer returns a summarizer that asks the requested model, on the
+// same account, to summarize turns dropped from the context.
+func (s *Server) contextSummarizer(modelName string, creds *auth.Credentials) contextwindow.Summarizer {
+	return func(ctx context.Context, contents []byte) (string, error) {
+		payload := `{"request":{"contents":[]}}`
+		payload, _ = sjson.SetRaw(payload, "request.contents", string(contents))
+		prompt := `{"role":"user","parts":[{"text":""}]}`
+		prompt, _ = sjson.Set(prompt, "parts.0.text", summaryPrompt)
+		payload, _ = sjson.SetRaw(payload, "request.contents.-1", prompt)
+		payload, _ = sjson.Set(payload, "request.generationConfig.maxOutputTokens", summaryMaxTokens)
+		if models.ModelSupportsThinking(modelName) {
+			// Think as little as the model allows; the budget comes on top of
+			// the summary, as it must stay below maxOutputTokens
+			budget := models.NormalizeThinkingBudget(modelName, 0)
+			payload, _ = sjson.Set(payload, "request.generationConfig.thinkingConfig.thinkingBudget", budget)
+			payload, _ = sjson.Set(payload, "request.generationConfig.thinkingConfig.include_thoughts", false)
+			payload, _ = sjson.Set(payload, "request.generationConfig.maxOutputTokens", summaryMaxTokens+budget)
+		}
+
+		resp, err := s.executor.Execute(ctx, creds, executor.Request{
+			Model:   modelName,
+			Payload: []byte(payload),
+		})
+		if err != nil {
+			return "", err
+		}
+
+		var summary strings.Builder
+		gjson.GetBytes(resp.Body, "response.candidates.0.content.parts").ForEach(func(_, part gjson.Result) bool {
+			if !part.Get("thought").Bool() {
+				summary.WriteString(part.Get("text").String())
+			}
+			return true
+		})
+		if summary.Len() == 0 {
+			return "", errors.New("empty summary")
+		}
+		return strings.TrimSpace(summary.String()), nil
+	}
+}
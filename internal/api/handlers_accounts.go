@@ -0,0 +1,229 @@
+package api
+
+import (
+	"html"
+	"net/http"
+
+	"github.com/anthropics/antigravity-wrapper/internal/auth"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+type startAccountOAuthRequest struct {
+	RedirectURI string `json:"redirect_uri"` // Overrides the configured callback URL
+}
+
+type startAccountOAuthResponse struct {
+	AuthURL     string `json:"auth_url"`
+	State       string `json:"state"`
+	RedirectURI string `json:"redirect_uri"`
+}
+
+type completeAccountOAuthRequest struct {
+	CallbackURL string `json:"callback_url"` // The URL the browser was redirected to
+}
+
+type updateAccountRequest struct {
+	Group string `json:"group"` // Empty moves the account to the shared pool
+}
+
+type accountResponse struct {
+	Email     string `json:"email"`
+	ProjectID string `json:"project_id,omitempty"`
+	Expired   string `json:"expired,omitempty"`
+	Group     string `json:"group,omitempty"`
+}
+
+// listAccountsHandler returns the accounts in the pool without their tokens.
+func (s *Server) listAccountsHandler(c *gin.Context) {
+	result := make([]accountResponse, 0)
+
+	if accountManager := s.accounts(); accountManager != nil {
+		for _, account := range accountManager.List() {
+			result = append(result, accountResponse{
+				Email:     account.Email,
+				ProjectID: account.ProjectID,
+				Expired:   account.Expired,
+				Group:     account.Group,
+			})
+		}
+	} else if s.credentials != nil {
+		result = append(result, accountResponse{
+			Email:     s.credentials.Email,
+			ProjectID: s.credentials.ProjectID,
+			Expired:   s.credentials.Expired,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": result,
+	})
+}
+
+// updateAccountHandler assigns a pooled account to an account group.
+func (s *Server) updateAccountHandler(c *gin.Context) {
+	email := c.Param("email")
+
+	var req updateAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": gin.H{
+				"message": "Invalid request body",
+				"type":    "invalid_request_error",
+			},
+		})
+		return
+	}
+
+	accountManager := s.accounts()
+	if accountManager == nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": gin.H{
+				"message": "No account pool configured",
+				"type":    "not_found_error",
+			},
+		})
+		return
+	}
+
+	if err := accountManager.SetGroup(email, req.Group); err != nil {
+		log.Warnf("Failed to update account %s: %v", email, err)
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": gin.H{
+				"message": "Account not found or update failed",
+				"type":    "not_found_error",
+			},
+		})
+		return
+	}
+
+	log.Infof("Assigned account %s to group %q", email, req.Group)
+	c.JSON(http.StatusOK, accountResponse{Email: email, Group: req.Group})
+}
+
+// startAccountOAuthHandler starts a browser-based OAuth login for a new account.
+func (s *Server) startAccountOAuthHandler(c *gin.Context) {
+	var req startAccountOAuthRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": gin.H{
+					"message": "Invalid request body",
+					"type":    "invalid_request_error",
+				},
+			})
+			return
+		}
+	}
+
+	redirectURI := req.RedirectURI
+	if redirectURI == "" {
+		redirectURI = s.oauthRedirectURL()
+	}
+
+	authURL, state, err := s.oauthFlow.Start(redirectURI)
+	if err != nil {
+		log.Errorf("Failed to start OAuth login: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": gin.H{
+				"message": "Failed to start OAuth login",
+				"type":    "internal_error",
+			},
+		})
+		return
+	}
+
+	log.Infof("Started OAuth login with redirect URI: %s", redirectURI)
+
+	c.JSON(http.StatusOK, startAccountOAuthResponse{
+		AuthURL:     authURL,
+		State:       state,
+		RedirectURI: redirectURI,
+	})
+}
+
+// oauthCallbackHandler completes an admin-driven OAuth login and adds the
+// resulting account to the pool.
+func (s *Server) oauthCallbackHandler(c *gin.Context) {
+	if errMsg := c.Query("error"); errMsg != "" {
+		writeOAuthResult(c, http.StatusBadRequest, "Login Failed", "Authentication failed: "+errMsg)
+		return
+	}
+
+	creds, err := s.oauthFlow.Complete(c.Request.Context(), c.Query("state"), c.Query("code"))
+	if err != nil {
+		log.Warnf("OAuth callback failed: %v", err)
+		writeOAuthResult(c, http.StatusBadRequest, "Login Failed", err.Error())
+		return
+	}
+
+	if err := s.addAccount(creds); err != nil {
+		log.Errorf("Failed to add account: %v", err)
+		writeOAuthResult(c, http.StatusInternalServerError, "Login Failed", "The account could not be saved.")
+		return
+	}
+
+	writeOAuthResult(c, http.StatusOK, "Login Successful", "Account "+creds.Email+" was added. You can close this window.")
+}
+
+// completeAccountOAuthHandler completes an admin-driven OAuth login from the
+// URL the browser was redirected to. It is used when the redirect URI is the
+// loopback callback, which the admin's browser cannot reach.
+func (s *Server) completeAccountOAuthHandler(c *gin.Context) {
+	var req completeAccountOAuthRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.CallbackURL == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": gin.H{
+				"message": "callback_url is required",
+				"type":    "invalid_request_error",
+			},
+		})
+		return
+	}
+
+	creds, err := s.oauthFlow.CompleteFromURL(c.Request.Context(), req.CallbackURL)
+	if err != nil {
+		log.Warnf("OAuth login failed: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": gin.H{
+				"message": err.Error(),
+				"type":    "invalid_request_error",
+			},
+		})
+		return
+	}
+
+	if err := s.addAccount(creds); err != nil {
+		log.Errorf("Failed to add account: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": gin.H{
+				"message": "The account could not be saved",
+				"type":    "internal_error",
+			},
+		})
+		return
+	}
+
+	log.Infof("Added account %s", creds.Email)
+	c.JSON(http.StatusOK, accountResponse{
+		Email:     creds.Email,
+		ProjectID: creds.ProjectID,
+		Expired:   creds.Expired,
+	})
+}
+
+// oauthRedirectURL returns the configured callback URL, or the loopback
+// callback the OAuth client is registered for. It is never derived from
+// request headers, which clients control.
+func (s *Server) oauthRedirectURL() string {
+	if s.cfg.OAuthRedirectURL != "" {
+		return s.cfg.OAuthRedirectURL
+	}
+	return auth.LoopbackRedirectURI
+}
+
+// writeOAuthResult renders a minimal HTML page for the OAuth callback.
+func writeOAuthResult(c *gin.Context, status int, title, message string) {
+	c.Header("Content-Type", "text/html")
+	c.String(status, "<h1>%s</h1><p>%s</p>", html.EscapeString(title), html.EscapeString(message))
+}
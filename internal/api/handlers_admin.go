@@ -1,31 +1,114 @@
 package api
 
 import (
+	"encoding/json"
 	"net/http"
 
+	"github.com/anthropics/antigravity-wrapper/internal/auth"
+	"github.com/anthropics/antigravity-wrapper/internal/metrics"
 	"github.com/anthropics/antigravity-wrapper/internal/models"
+	"github.com/anthropics/antigravity-wrapper/internal/safety"
 	"github.com/gin-gonic/gin"
 	log "github.com/sirupsen/logrus"
 )
 
 type generateKeyRequest struct {
-	Note          string   `json:"note"`
-	RateLimit     int      `json:"rate_limit"`     // RPM limit
-	AllowedModels []string `json:"allowed_models"` // Models this key can access
+	Note           string   `json:"note"`
+	RateLimit      int      `json:"rate_limit"`       // RPM limit
+	TokenRateLimit int      `json:"token_rate_limit"` // TPM limit
+	AllowedModels  []string `json:"allowed_models"`   // Models this key can access
+	AccountGroup   string   `json:"account_group"`    // Account group to bill
+	SharedFallback bool     `json:"shared_fallback"`  // Fall back to the shared pool
+	Priority       int      `json:"priority"`         // Queue priority tier
+	ResponseCache  *bool    `json:"response_cache"`   // Response cache override
+	ThinkingBudget *int     `json:"thinking_budget"`  // Default thinking budget
+	FilesQuota     int      `json:"files_quota"`      // Files API storage in megabytes
+
+	Safety *safety.Policy `json:"safety"` // Safety policy override
 }
 
+// updateKeyRequest holds the settings to change. Fields missing from the
+// request keep their current value; the nullable overrides are cleared by an
+// explicit null.
 type updateKeyRequest struct {
-	Note          string   `json:"note"`
-	RateLimit     int      `json:"rate_limit"`
-	AllowedModels []string `json:"allowed_models"`
+	Note           *string         `json:"note"`
+	RateLimit      *int            `json:"rate_limit"`
+	TokenRateLimit *int            `json:"token_rate_limit"`
+	AllowedModels  *[]string       `json:"allowed_models"`
+	AccountGroup   *string         `json:"account_group"`
+	SharedFallback *bool           `json:"shared_fallback"`
+	Priority       *int            `json:"priority"`
+	ResponseCache  optional[*bool] `json:"response_cache"`
+	ThinkingBudget optional[*int]  `json:"thinking_budget"`
+	FilesQuota     *int            `json:"files_quota"`
+
+	Safety optional[*safety.Policy] `json:"safety"`
+}
+
+// optional is a request field that records whether it was present, so that
+// null can be told apart from a missing field.
+type optional[T any] struct {
+	Set   bool
+	Value T
+}
+
+func (o *optional[T]) UnmarshalJSON(data []byte) error {
+	o.Set = true
+	return json.Unmarshal(data, &o.Value)
+}
+
+// apply copies the fields present in the request to apiKey.
+func (req *updateKeyRequest) apply(apiKey *auth.APIKey) {
+	if req.Note != nil {
+		apiKey.Note = *req.Note
+	}
+	if req.RateLimit != nil {
+		apiKey.RateLimit = *req.RateLimit
+	}
+	if req.TokenRateLimit != nil {
+		apiKey.TokenRateLimit = *req.TokenRateLimit
+	}
+	if req.AllowedModels != nil {
+		apiKey.AllowedModels = *req.AllowedModels
+	}
+	if req.AccountGroup != nil {
+		apiKey.AccountGroup = *req.AccountGroup
+	}
+	if req.SharedFallback != nil {
+		apiKey.SharedFallback = *req.SharedFallback
+	}
+	if req.Priority != nil {
+		apiKey.Priority = *req.Priority
+	}
+	if req.ResponseCache.Set {
+		apiKey.ResponseCache = req.ResponseCache.Value
+	}
+	if req.ThinkingBudget.Set {
+		apiKey.ThinkingBudget = req.ThinkingBudget.Value
+	}
+	if req.FilesQuota != nil {
+		apiKey.FilesQuota = *req.FilesQuota
+	}
+	if req.Safety.Set {
+		apiKey.Safety = req.Safety.Value
+	}
 }
 
 type generateKeyResponse struct {
-	Key           string   `json:"key"`
-	CreatedAt     string   `json:"created_at"`
-	Note          string   `json:"note,omitempty"`
-	RateLimit     int      `json:"rate_limit,omitempty"`
-	AllowedModels []string `json:"allowed_models,omitempty"`
+	Key            string   `json:"key"`
+	CreatedAt      string   `json:"created_at"`
+	Note           string   `json:"note,omitempty"`
+	RateLimit      int      `json:"rate_limit,omitempty"`
+	TokenRateLimit int      `json:"token_rate_limit,omitempty"`
+	AllowedModels  []string `json:"allowed_models,omitempty"`
+	AccountGroup   string   `json:"account_group,omitempty"`
+	SharedFallback bool     `json:"shared_fallback,omitempty"`
+	Priority       int      `json:"priority,omitempty"`
+	ResponseCache  *bool    `json:"response_cache,omitempty"`
+	ThinkingBudget *int     `json:"thinking_budget,omitempty"`
+	FilesQuota     int      `json:"files_quota,omitempty"`
+
+	Safety *safety.Policy `json:"safety,omitempty"`
 }
 
 // generateKeyHandler handles the generation of new API keys.
@@ -41,9 +124,32 @@ func (s *Server) generateKeyHandler(c *gin.Context) {
 		})
 		return
 	}
+	if req.Safety != nil {
+		if err := req.Safety.Validate(); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": gin.H{
+					"message": err.Error(),
+					"type":    "invalid_request_error",
+				},
+			})
+			return
+		}
+	}
 
 	// Generate key
-	apiKey, err := s.keyStore.Generate(req.Note, req.RateLimit, req.AllowedModels)
+	apiKey, err := s.keyStore.Generate(auth.APIKey{
+		Note:           req.Note,
+		RateLimit:      req.RateLimit,
+		TokenRateLimit: req.TokenRateLimit,
+		AllowedModels:  req.AllowedModels,
+		AccountGroup:   req.AccountGroup,
+		SharedFallback: req.SharedFallback,
+		Priority:       req.Priority,
+		ResponseCache:  req.ResponseCache,
+		ThinkingBudget: req.ThinkingBudget,
+		FilesQuota:     req.FilesQuota,
+		Safety:         req.Safety,
+	})
 	if err != nil {
 		log.Errorf("Failed to generate API key: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -58,11 +164,19 @@ func (s *Server) generateKeyHandler(c *gin.Context) {
 	log.Infof("Generated new API key with note: %s", req.Note)
 
 	c.JSON(http.StatusCreated, generateKeyResponse{
-		Key:           apiKey.Key,
-		CreatedAt:     apiKey.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
-		Note:          apiKey.Note,
-		RateLimit:     apiKey.RateLimit,
-		AllowedModels: apiKey.AllowedModels,
+		Key:            apiKey.Key,
+		CreatedAt:      apiKey.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+		Note:           apiKey.Note,
+		RateLimit:      apiKey.RateLimit,
+		TokenRateLimit: apiKey.TokenRateLimit,
+		AllowedModels:  apiKey.AllowedModels,
+		AccountGroup:   apiKey.AccountGroup,
+		SharedFallback: apiKey.SharedFallback,
+		Priority:       apiKey.Priority,
+		ResponseCache:  apiKey.ResponseCache,
+		ThinkingBudget: apiKey.ThinkingBudget,
+		FilesQuota:     apiKey.FilesQuota,
+		Safety:         apiKey.Safety,
 	})
 }
 
@@ -89,8 +203,19 @@ func (s *Server) updateKeyHandler(c *gin.Context) {
 		})
 		return
 	}
+	if req.Safety.Value != nil {
+		if err := req.Safety.Value.Validate(); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": gin.H{
+					"message": err.Error(),
+					"type":    "invalid_request_error",
+				},
+			})
+			return
+		}
+	}
 
-	apiKey, err := s.keyStore.Update(key, req.Note, req.RateLimit, req.AllowedModels)
+	apiKey, err := s.keyStore.Update(key, req.apply)
 	if err != nil {
 		log.Warnf("Failed to update API key: %v", err)
 		c.JSON(http.StatusNotFound, gin.H{
@@ -173,3 +298,12 @@ func (s *Server) listModelsHandler(c *gin.Context) {
 		"data": result,
 	})
 }
+
+// metricsHandler exposes server metrics in the Prometheus text format.
+func (s *Server) metricsHandler(c *gin.Context) {
+	c.Header("Content-Type", "text/plain; version=0.0.4")
+	c.Status(http.StatusOK)
+	if err := metrics.Default().WriteText(c.Writer); err != nil {
+		log.Warnf("Failed to write metrics: %v", err)
+	}
+}
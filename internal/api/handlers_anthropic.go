@@ -3,16 +3,21 @@ package api
 import (
 	"io"
 	"net/http"
+	"strconv"
 
 	"github.com/anthropics/antigravity-wrapper/internal/auth"
 	"github.com/anthropics/antigravity-wrapper/internal/executor"
-	"github.com/anthropics/antigravity-wrapper/internal/models"
+	"github.com/anthropics/antigravity-wrapper/internal/tokenizer"
 	"github.com/anthropics/antigravity-wrapper/internal/translator"
 	"github.com/gin-gonic/gin"
 	log "github.com/sirupsen/logrus"
 	"github.com/tidwall/gjson"
 )
 
+// extensionFieldsHeader opts a Claude request into the native_finish_reason and
+// safety_ratings extension fields, which are not part of the Anthropic schema.
+const extensionFieldsHeader = "X-Extension-Fields"
+
 // messagesHandler handles Claude/Anthropic Messages API requests.
 func (s *Server) messagesHandler(c *gin.Context) {
 	if !s.hasCredentials() {
@@ -43,64 +48,108 @@ func (s *Server) messagesHandler(c *gin.Context) {
 	}
 	stream := gjson.GetBytes(body, "stream").Bool()
 
-	// Convert Claude request to Antigravity format
-	payload := translator.ConvertClaudeRequestToAntigravity(modelName, body, stream)
+	// Inline images and documents referenced by URL or file_id
+	body, ok := s.inlineRemoteMedia(c, body)
+	if !ok {
+		return
+	}
 
-	// Apply thinking normalization
-	payload = models.ApplyDefaultThinkingIfNeeded(modelName, payload)
-	payload = models.StripThinkingConfigIfUnsupported(modelName, payload)
+	// Convert Claude request to Antigravity format
+	extensionFields, _ := strconv.ParseBool(c.GetHeader(extensionFieldsHeader))
+	opts := &translator.TranslatorOptions{
+		Signatures:      s.signatures,
+		ToolNames:       translator.ToolNames(body),
+		Documents:       translator.Documents(body),
+		ExtensionFields: extensionFields,
+	}
+	payload := translator.ConvertClaudeRequestToAntigravity(modelName, body, stream, opts)
+	payload, ok = s.applySafety(c, modelName, body, payload)
+	if !ok {
+		return
+	}
 
-	// Get credentials for this request (round-robin if available)
-	creds := s.getNextCredentials()
+	// Apply thinking defaults and normalization
+	payload = s.applyThinking(c, modelName, payload)
+
+	// Get credentials for this request (sticky per conversation, round-robin
+	// otherwise), unless it is answered from the response cache
+	sessionKey := resolveSessionKey(c, body)
+	var creds *auth.Credentials
+	if !s.lookupResponseCache(c, modelName, payload) {
+		var release func()
+		creds, payload, release, ok = s.admitRequest(c, modelName, payload, sessionKey)
+		if !ok {
+			return
+		}
+		defer release()
+	}
 
 	if stream {
-		s.handleStreamingClaude(c, modelName, payload, creds)
+		s.handleStreamingClaude(c, modelName, payload, creds, sessionKey, opts)
 	} else {
-		s.handleNonStreamingClaude(c, modelName, payload, creds)
+		s.handleNonStreamingClaude(c, modelName, payload, creds, sessionKey, opts)
 	}
 }
 
 // handleStreamingClaude handles streaming Claude responses.
-func (s *Server) handleStreamingClaude(c *gin.Context, modelName string, payload []byte, creds *auth.Credentials) {
-	streamChan, err := s.executor.ExecuteStream(c.Request.Context(), creds, executor.Request{
-		Model:   modelName,
-		Payload: payload,
-		Stream:  true,
-	})
+func (s *Server) handleStreamingClaude(c *gin.Context, modelName string, payload []byte, creds *auth.Credentials, sessionKey string, opts *translator.TranslatorOptions) {
+	// Report the estimated input tokens in message_start unless the upstream
+	// reports them with the first chunk
+	state := &translator.ClaudeStreamState{InputTokens: int64(tokenizer.EstimateRequest(payload))}
+
+	// Keep the connection alive with ping events while the upstream is silent,
+	// e.g. while it starts the response or during long thinking phases
+	ping := func() string { return translator.ClaudePing(modelName, state) }
+	streamChan, heartbeat, err := s.openStream(c, creds, executor.Request{
+		Model:     modelName,
+		Payload:   payload,
+		Stream:    true,
+		SessionID: stableSessionID(sessionKey),
+		OnUsage:   s.tokenUsageRecorder(c),
+	}, ping)
 	if err != nil {
 		log.Errorf("Streaming request failed: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": gin.H{
-				"message": err.Error(),
-				"type":    "api_error",
-			},
-		})
+		writeStreamError(c, err, translator.ClaudeStreamError(err.Error()))
 		return
 	}
+	defer heartbeat.Stop()
+
+stream:
+	for {
+		select {
+		case chunk, ok := <-streamChan:
+			if !ok {
+				break stream
+			}
+			if chunk.Err != nil {
+				log.Errorf("Stream chunk error: %v", chunk.Err)
+				c.Writer.WriteString(translator.ClaudeStreamError(chunk.Err.Error()))
+				c.Writer.Flush()
+				return
+			}
+			heartbeat.Reset()
 
-	c.Header("Content-Type", "text/event-stream")
-	c.Header("Cache-Control", "no-cache")
-	c.Header("Connection", "keep-alive")
-
-	state := &translator.ClaudeStreamState{}
-
-	for chunk := range streamChan {
-		if chunk.Err != nil {
-			log.Errorf("Stream chunk error: %v", chunk.Err)
-			break
-		}
+			if chunk.PromptTokens > 0 && !state.HasFirstResponse {
+				state.InputTokens = chunk.PromptTokens
+			}
 
-		responses := translator.ConvertAntigravityResponseToClaude(modelName, chunk.Data, state)
-		for _, resp := range responses {
-			if resp != "" {
-				c.Writer.WriteString(resp)
-				c.Writer.Flush()
+			responses := translator.ConvertAntigravityResponseToClaude(modelName, chunk.Data, state, opts)
+			for _, resp := range responses {
+				if resp != "" {
+					c.Writer.WriteString(resp)
+					c.Writer.Flush()
+				}
 			}
+		case <-heartbeat.C():
+			c.Writer.WriteString(ping())
+			c.Writer.Flush()
+		case <-c.Request.Context().Done():
+			return
 		}
 	}
 
 	// Send final [DONE] through translator
-	finalResponses := translator.ConvertAntigravityResponseToClaude(modelName, []byte("[DONE]"), state)
+	finalResponses := translator.ConvertAntigravityResponseToClaude(modelName, []byte("[DONE]"), state, opts)
 	for _, resp := range finalResponses {
 		if resp != "" {
 			c.Writer.WriteString(resp)
@@ -110,11 +159,13 @@ func (s *Server) handleStreamingClaude(c *gin.Context, modelName string, payload
 }
 
 // handleNonStreamingClaude handles non-streaming Claude responses.
-func (s *Server) handleNonStreamingClaude(c *gin.Context, modelName string, payload []byte, creds *auth.Credentials) {
-	resp, err := s.executor.Execute(c.Request.Context(), creds, executor.Request{
-		Model:   modelName,
-		Payload: payload,
-		Stream:  false,
+func (s *Server) handleNonStreamingClaude(c *gin.Context, modelName string, payload []byte, creds *auth.Credentials, sessionKey string, opts *translator.TranslatorOptions) {
+	resp, err := s.execute(c, creds, executor.Request{
+		Model:     modelName,
+		Payload:   payload,
+		Stream:    false,
+		SessionID: stableSessionID(sessionKey),
+		OnUsage:   s.tokenUsageRecorder(c),
 	})
 	if err != nil {
 		log.Errorf("Non-streaming request failed: %v", err)
@@ -131,7 +182,7 @@ func (s *Server) handleNonStreamingClaude(c *gin.Context, modelName string, payl
 		return
 	}
 
-	converted := translator.ConvertAntigravityResponseToClaudeNonStream(modelName, resp.Body)
+	converted := translator.ConvertAntigravityResponseToClaudeNonStream(modelName, resp.Body, opts)
 	c.Header("Content-Type", "application/json")
 	c.String(http.StatusOK, converted)
 }
\ No newline at end of file
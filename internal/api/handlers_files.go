@@ -0,0 +1,216 @@
+package api
+
+import (
+	"errors"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/anthropics/antigravity-wrapper/internal/files"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// uploadFileHandler stores a file uploaded as multipart form data.
+func (s *Server) uploadFileHandler(c *gin.Context) {
+	if !s.requireFiles(c) {
+		return
+	}
+
+	if s.cfg.FilesMaxSize > 0 {
+		// Leave room for the multipart envelope and other form fields
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, int64(s.cfg.FilesMaxSize)<<20+1<<20)
+	}
+	header, err := c.FormFile("file")
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			fileError(c, http.StatusRequestEntityTooLarge, "invalid_request_error", files.ErrTooLarge.Error())
+			return
+		}
+		fileError(c, http.StatusBadRequest, "invalid_request_error", "A file must be uploaded in the 'file' form field")
+		return
+	}
+
+	mimeType, _, _ := mime.ParseMediaType(header.Header.Get("Content-Type"))
+	if mimeType == "" || mimeType == "application/octet-stream" {
+		if byExtension, _, _ := mime.ParseMediaType(mime.TypeByExtension(filepath.Ext(header.Filename))); byExtension != "" {
+			mimeType = byExtension
+		}
+	}
+	if mimeType == "" {
+		mimeType = "application/octet-stream"
+	}
+
+	content, err := header.Open()
+	if err != nil {
+		fileError(c, http.StatusBadRequest, "invalid_request_error", "Failed to read uploaded file")
+		return
+	}
+	defer content.Close()
+
+	file, err := s.files.Create(extractAPIKey(c), header.Filename, mimeType, c.PostForm("purpose"), content, s.filesQuota(c))
+	switch {
+	case errors.Is(err, files.ErrTooLarge), errors.Is(err, files.ErrQuotaExceeded):
+		fileError(c, http.StatusRequestEntityTooLarge, "invalid_request_error", err.Error())
+		return
+	case err != nil:
+		log.Errorf("Failed to store file: %v", err)
+		fileError(c, http.StatusInternalServerError, "internal_error", "Failed to store file")
+		return
+	}
+
+	log.Infof("Stored file %s (%d bytes)", file.ID, file.Bytes)
+	c.JSON(http.StatusOK, fileObject(c, file))
+}
+
+// listFilesHandler lists the files of the API key.
+func (s *Server) listFilesHandler(c *gin.Context) {
+	if !s.requireFiles(c) {
+		return
+	}
+
+	list := s.files.List(extractAPIKey(c))
+	purpose := c.Query("purpose")
+	data := make([]gin.H, 0, len(list))
+	for _, file := range list {
+		if purpose == "" || file.Purpose == purpose {
+			data = append(data, fileObject(c, file))
+		}
+	}
+
+	if anthropicStyle(c) {
+		response := gin.H{"data": data, "has_more": false, "first_id": nil, "last_id": nil}
+		if len(data) > 0 {
+			response["first_id"] = data[0]["id"]
+			response["last_id"] = data[len(data)-1]["id"]
+		}
+		c.JSON(http.StatusOK, response)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"object": "list", "data": data})
+}
+
+// getFileHandler returns the metadata of a file.
+func (s *Server) getFileHandler(c *gin.Context) {
+	if !s.requireFiles(c) {
+		return
+	}
+
+	file, err := s.files.Get(extractAPIKey(c), c.Param("id"))
+	if err != nil {
+		fileLookupError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, fileObject(c, file))
+}
+
+// fileContentHandler returns the content of a file.
+func (s *Server) fileContentHandler(c *gin.Context) {
+	if !s.requireFiles(c) {
+		return
+	}
+
+	file, data, err := s.files.Content(extractAPIKey(c), c.Param("id"))
+	if err != nil {
+		fileLookupError(c, err)
+		return
+	}
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": file.Filename}))
+	c.Data(http.StatusOK, file.MIMEType, data)
+}
+
+// deleteFileHandler removes a file.
+func (s *Server) deleteFileHandler(c *gin.Context) {
+	if !s.requireFiles(c) {
+		return
+	}
+
+	id := c.Param("id")
+	if err := s.files.Delete(extractAPIKey(c), id); err != nil {
+		fileLookupError(c, err)
+		return
+	}
+
+	log.Infof("Deleted file %s", id)
+	if anthropicStyle(c) {
+		c.JSON(http.StatusOK, gin.H{"id": id, "type": "file_deleted"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"id": id, "object": "file", "deleted": true})
+}
+
+// requireFiles responds with 503 and returns false when the Files API is not
+// available because no data directory is configured.
+func (s *Server) requireFiles(c *gin.Context) bool {
+	if s.files != nil {
+		return true
+	}
+	fileError(c, http.StatusServiceUnavailable, "service_unavailable", "The Files API requires data_dir to be configured")
+	return false
+}
+
+// filesQuota returns the Files API storage quota of the request's API key in
+// bytes (0 = unlimited).
+func (s *Server) filesQuota(c *gin.Context) int64 {
+	quota := s.cfg.FilesQuota
+	if keyData := s.lookupKey(c); keyData != nil && keyData.FilesQuota > 0 {
+		quota = keyData.FilesQuota
+	}
+	return int64(quota) << 20
+}
+
+// anthropicStyle reports whether a Files API request comes from an Anthropic
+// client, which expects Anthropic-style objects.
+func anthropicStyle(c *gin.Context) bool {
+	return c.GetHeader("anthropic-version") != "" || strings.Contains(c.GetHeader("anthropic-beta"), "files-api")
+}
+
+// fileObject describes a file in the format of the client.
+func fileObject(c *gin.Context, file *files.File) gin.H {
+	if anthropicStyle(c) {
+		return gin.H{
+			"id":           file.ID,
+			"type":         "file",
+			"filename":     file.Filename,
+			"mime_type":    file.MIMEType,
+			"size_bytes":   file.Bytes,
+			"created_at":   file.CreatedAt.Format(time.RFC3339),
+			"downloadable": true,
+		}
+	}
+	purpose := file.Purpose
+	if purpose == "" {
+		purpose = "user_data"
+	}
+	return gin.H{
+		"id":         file.ID,
+		"object":     "file",
+		"bytes":      file.Bytes,
+		"created_at": file.CreatedAt.Unix(),
+		"filename":   file.Filename,
+		"purpose":    purpose,
+		"status":     "processed",
+	}
+}
+
+// fileLookupError responds to a failed file lookup.
+func fileLookupError(c *gin.Context, err error) {
+	if errors.Is(err, files.ErrNotFound) {
+		fileError(c, http.StatusNotFound, "not_found_error", "No such file: "+c.Param("id"))
+		return
+	}
+	log.Errorf("Failed to read file: %v", err)
+	fileError(c, http.StatusInternalServerError, "internal_error", "Failed to read file")
+}
+
+func fileError(c *gin.Context, status int, errorType, message string) {
+	c.JSON(status, gin.H{
+		"error": gin.H{
+			"message": message,
+			"type":    errorType,
+		},
+	})
+}
@@ -6,7 +6,6 @@ import (
 
 	"github.com/anthropics/antigravity-wrapper/internal/auth"
 	"github.com/anthropics/antigravity-wrapper/internal/executor"
-	"github.com/anthropics/antigravity-wrapper/internal/models"
 	"github.com/anthropics/antigravity-wrapper/internal/translator"
 	"github.com/gin-gonic/gin"
 	log "github.com/sirupsen/logrus"
@@ -43,20 +42,44 @@ func (s *Server) chatCompletionsHandler(c *gin.Context) {
 	}
 	stream := gjson.GetBytes(body, "stream").Bool()
 
+	// Inline images and documents referenced by URL or file_id
+	body, ok := s.inlineRemoteMedia(c, body)
+	if !ok {
+		return
+	}
+
 	// Convert OpenAI request to Antigravity format
 	payload := translator.ConvertOpenAIRequestToAntigravity(modelName, body, stream)
+	payload, ok = s.applySafety(c, modelName, body, payload)
+	if !ok {
+		return
+	}
 
-	// Apply thinking normalization
-	payload = models.ApplyDefaultThinkingIfNeeded(modelName, payload)
-	payload = models.StripThinkingConfigIfUnsupported(modelName, payload)
+	// Apply thinking defaults and normalization
+	payload = s.applyThinking(c, modelName, payload)
+
+	// Get credentials for this request (sticky per conversation, round-robin
+	// otherwise), unless it is answered from the response cache
+	sessionKey := resolveSessionKey(c, body)
+	var creds *auth.Credentials
+	if !s.lookupResponseCache(c, modelName, payload) {
+		var release func()
+		creds, payload, release, ok = s.admitRequest(c, modelName, payload, sessionKey)
+		if !ok {
+			return
+		}
+		defer release()
+	}
 
-	// Get credentials for this request (round-robin if available)
-	creds := s.getNextCredentials()
+	opts := &translator.TranslatorOptions{
+		ThinkingOutput: translator.ResolveThinkingOutput(body, s.cfg.ThinkingAsContent),
+		ToolNames:      translator.ToolNames(body),
+	}
 
 	if stream {
-		s.handleStreamingOpenAI(c, modelName, payload, creds)
+		s.handleStreamingOpenAI(c, modelName, payload, creds, sessionKey, opts)
 	} else {
-		s.handleNonStreamingOpenAI(c, modelName, payload, creds)
+		s.handleNonStreamingOpenAI(c, modelName, payload, creds, sessionKey, opts)
 	}
 }
 
@@ -90,61 +113,120 @@ func (s *Server) responsesHandler(c *gin.Context) {
 	}
 	stream := gjson.GetBytes(body, "stream").Bool()
 
-	// For Responses API, we use the OpenAI translator (simplified approach)
+	// For Responses API, we use the OpenAI translator (simplified approach),
+	// with the input items rewritten as chat messages
+	body, ok := responsesMessages(c, body)
+	if !ok {
+		return
+	}
+
+	// Inline images and documents referenced by URL or file_id
+	body, ok = s.inlineRemoteMedia(c, body)
+	if !ok {
+		return
+	}
+
 	payload := translator.ConvertOpenAIRequestToAntigravity(modelName, body, stream)
+	payload, ok = s.applySafety(c, modelName, body, payload)
+	if !ok {
+		return
+	}
 
-	// Apply thinking normalization
-	payload = models.ApplyDefaultThinkingIfNeeded(modelName, payload)
-	payload = models.StripThinkingConfigIfUnsupported(modelName, payload)
+	// Apply thinking defaults and normalization
+	payload = s.applyThinking(c, modelName, payload)
+
+	// Get credentials for this request (sticky per conversation, round-robin
+	// otherwise), unless it is answered from the response cache
+	sessionKey := resolveSessionKey(c, body)
+	var creds *auth.Credentials
+	if !s.lookupResponseCache(c, modelName, payload) {
+		var release func()
+		creds, payload, release, ok = s.admitRequest(c, modelName, payload, sessionKey)
+		if !ok {
+			return
+		}
+		defer release()
+	}
 
-	// Get credentials for this request (round-robin if available)
-	creds := s.getNextCredentials()
+	opts := &translator.TranslatorOptions{
+		ThinkingOutput: translator.ResolveThinkingOutput(body, s.cfg.ThinkingAsContent),
+		ToolNames:      translator.ToolNames(body),
+	}
 
 	if stream {
-		s.handleStreamingResponses(c, modelName, payload, creds)
+		s.handleStreamingResponses(c, modelName, payload, creds, sessionKey, opts)
 	} else {
-		s.handleNonStreamingResponses(c, modelName, payload, creds)
+		s.handleNonStreamingResponses(c, modelName, payload, creds, sessionKey, opts)
 	}
 }
 
-// handleStreamingOpenAI handles streaming OpenAI responses.
-func (s *Server) handleStreamingOpenAI(c *gin.Context, modelName string, payload []byte, creds *auth.Credentials) {
-	streamChan, err := s.executor.ExecuteStream(c.Request.Context(), creds, executor.Request{
-		Model:   modelName,
-		Payload: payload,
-		Stream:  true,
-	})
+// responsesMessages rewrites the input items of a Responses API request as chat
+// messages. If an item cannot be converted, a 400 response is written and false
+// is returned.
+func responsesMessages(c *gin.Context, body []byte) ([]byte, bool) {
+	body, err := translator.ResponsesInputToMessages(body)
 	if err != nil {
-		log.Errorf("Streaming request failed: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{
+		c.JSON(http.StatusBadRequest, gin.H{
 			"error": gin.H{
 				"message": err.Error(),
-				"type":    "api_error",
+				"type":    "invalid_request_error",
 			},
 		})
-		return
+		return nil, false
 	}
+	return body, true
+}
 
-	c.Header("Content-Type", "text/event-stream")
-	c.Header("Cache-Control", "no-cache")
-	c.Header("Connection", "keep-alive")
+// openAIKeepalive returns the SSE comment that keeps OpenAI streams alive.
+func openAIKeepalive() string {
+	return ": keepalive\n\n"
+}
 
-	state := &translator.OpenAIStreamState{}
+// handleStreamingOpenAI handles streaming OpenAI responses.
+func (s *Server) handleStreamingOpenAI(c *gin.Context, modelName string, payload []byte, creds *auth.Credentials, sessionKey string, opts *translator.TranslatorOptions) {
+	// Keep the connection alive with SSE comments while the upstream is silent,
+	// e.g. while it starts the response or during long thinking phases
+	streamChan, heartbeat, err := s.openStream(c, creds, executor.Request{
+		Model:     modelName,
+		Payload:   payload,
+		Stream:    true,
+		SessionID: stableSessionID(sessionKey),
+		OnUsage:   s.tokenUsageRecorder(c),
+	}, openAIKeepalive)
+	if err != nil {
+		log.Errorf("Streaming request failed: %v", err)
+		writeStreamError(c, err, translator.OpenAIStreamError(err.Error()))
+		return
+	}
+	defer heartbeat.Stop()
 
-	for chunk := range streamChan {
-		if chunk.Err != nil {
-			log.Errorf("Stream chunk error: %v", chunk.Err)
-			break
-		}
+	state := &translator.OpenAIStreamState{}
 
-		responses := translator.ConvertAntigravityResponseToOpenAI(modelName, chunk.Data, state, &translator.TranslatorOptions{
-			ThinkingAsContent: s.cfg.ThinkingAsContent,
-		})
-		for _, resp := range responses {
-			if resp != "" {
-				c.Writer.WriteString("data: " + resp + "\n\n")
-				c.Writer.Flush()
+stream:
+	for {
+		select {
+		case chunk, ok := <-streamChan:
+			if !ok {
+				break stream
 			}
+			if chunk.Err != nil {
+				log.Errorf("Stream chunk error: %v", chunk.Err)
+				break stream
+			}
+			heartbeat.Reset()
+
+			responses := translator.ConvertAntigravityResponseToOpenAI(modelName, chunk.Data, state, opts)
+			for _, resp := range responses {
+				if resp != "" {
+					c.Writer.WriteString("data: " + resp + "\n\n")
+					c.Writer.Flush()
+				}
+			}
+		case <-heartbeat.C():
+			c.Writer.WriteString(openAIKeepalive())
+			c.Writer.Flush()
+		case <-c.Request.Context().Done():
+			return
 		}
 	}
 
@@ -153,11 +235,13 @@ func (s *Server) handleStreamingOpenAI(c *gin.Context, modelName string, payload
 }
 
 // handleNonStreamingOpenAI handles non-streaming OpenAI responses.
-func (s *Server) handleNonStreamingOpenAI(c *gin.Context, modelName string, payload []byte, creds *auth.Credentials) {
-	resp, err := s.executor.Execute(c.Request.Context(), creds, executor.Request{
-		Model:   modelName,
-		Payload: payload,
-		Stream:  false,
+func (s *Server) handleNonStreamingOpenAI(c *gin.Context, modelName string, payload []byte, creds *auth.Credentials, sessionKey string, opts *translator.TranslatorOptions) {
+	resp, err := s.execute(c, creds, executor.Request{
+		Model:     modelName,
+		Payload:   payload,
+		Stream:    false,
+		SessionID: stableSessionID(sessionKey),
+		OnUsage:   s.tokenUsageRecorder(c),
 	})
 	if err != nil {
 		log.Errorf("Non-streaming request failed: %v", err)
@@ -174,51 +258,56 @@ func (s *Server) handleNonStreamingOpenAI(c *gin.Context, modelName string, payl
 		return
 	}
 
-	converted := translator.ConvertAntigravityResponseToOpenAINonStream(modelName, resp.Body, &translator.TranslatorOptions{
-		ThinkingAsContent: s.cfg.ThinkingAsContent,
-	})
+	converted := translator.ConvertAntigravityResponseToOpenAINonStream(modelName, resp.Body, opts)
 	c.Header("Content-Type", "application/json")
 	c.String(http.StatusOK, converted)
 }
 
 // handleStreamingResponses handles streaming Responses API.
-func (s *Server) handleStreamingResponses(c *gin.Context, modelName string, payload []byte, creds *auth.Credentials) {
-	streamChan, err := s.executor.ExecuteStream(c.Request.Context(), creds, executor.Request{
-		Model:   modelName,
-		Payload: payload,
-		Stream:  true,
-	})
+func (s *Server) handleStreamingResponses(c *gin.Context, modelName string, payload []byte, creds *auth.Credentials, sessionKey string, opts *translator.TranslatorOptions) {
+	// Keep the connection alive with SSE comments while the upstream is silent,
+	// e.g. while it starts the response or during long thinking phases
+	streamChan, heartbeat, err := s.openStream(c, creds, executor.Request{
+		Model:     modelName,
+		Payload:   payload,
+		Stream:    true,
+		SessionID: stableSessionID(sessionKey),
+		OnUsage:   s.tokenUsageRecorder(c),
+	}, openAIKeepalive)
 	if err != nil {
 		log.Errorf("Streaming request failed: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": gin.H{
-				"message": err.Error(),
-				"type":    "api_error",
-			},
-		})
+		writeStreamError(c, err, translator.OpenAIStreamError(err.Error()))
 		return
 	}
-
-	c.Header("Content-Type", "text/event-stream")
-	c.Header("Cache-Control", "no-cache")
-	c.Header("Connection", "keep-alive")
+	defer heartbeat.Stop()
 
 	state := &translator.OpenAIStreamState{}
 
-	for chunk := range streamChan {
-		if chunk.Err != nil {
-			log.Errorf("Stream chunk error: %v", chunk.Err)
-			break
-		}
-
-		responses := translator.ConvertAntigravityResponseToOpenAI(modelName, chunk.Data, state, &translator.TranslatorOptions{
-			ThinkingAsContent: s.cfg.ThinkingAsContent,
-		})
-		for _, resp := range responses {
-			if resp != "" {
-				c.Writer.WriteString("data: " + resp + "\n\n")
-				c.Writer.Flush()
+stream:
+	for {
+		select {
+		case chunk, ok := <-streamChan:
+			if !ok {
+				break stream
 			}
+			if chunk.Err != nil {
+				log.Errorf("Stream chunk error: %v", chunk.Err)
+				break stream
+			}
+			heartbeat.Reset()
+
+			responses := translator.ConvertAntigravityResponseToOpenAI(modelName, chunk.Data, state, opts)
+			for _, resp := range responses {
+				if resp != "" {
+					c.Writer.WriteString("data: " + resp + "\n\n")
+					c.Writer.Flush()
+				}
+			}
+		case <-heartbeat.C():
+			c.Writer.WriteString(openAIKeepalive())
+			c.Writer.Flush()
+		case <-c.Request.Context().Done():
+			return
 		}
 	}
 
@@ -227,11 +316,13 @@ func (s *Server) handleStreamingResponses(c *gin.Context, modelName string, payl
 }
 
 // handleNonStreamingResponses handles non-streaming Responses API.
-func (s *Server) handleNonStreamingResponses(c *gin.Context, modelName string, payload []byte, creds *auth.Credentials) {
-	resp, err := s.executor.Execute(c.Request.Context(), creds, executor.Request{
-		Model:   modelName,
-		Payload: payload,
-		Stream:  false,
+func (s *Server) handleNonStreamingResponses(c *gin.Context, modelName string, payload []byte, creds *auth.Credentials, sessionKey string, opts *translator.TranslatorOptions) {
+	resp, err := s.execute(c, creds, executor.Request{
+		Model:     modelName,
+		Payload:   payload,
+		Stream:    false,
+		SessionID: stableSessionID(sessionKey),
+		OnUsage:   s.tokenUsageRecorder(c),
 	})
 	if err != nil {
 		log.Errorf("Non-streaming request failed: %v", err)
@@ -248,9 +339,7 @@ func (s *Server) handleNonStreamingResponses(c *gin.Context, modelName string, p
 		return
 	}
 
-	converted := translator.ConvertAntigravityResponseToOpenAINonStream(modelName, resp.Body, &translator.TranslatorOptions{
-		ThinkingAsContent: s.cfg.ThinkingAsContent,
-	})
+	converted := translator.ConvertAntigravityResponseToOpenAINonStream(modelName, resp.Body, opts)
 	c.Header("Content-Type", "application/json")
 	c.String(http.StatusOK, converted)
 }
@@ -0,0 +1,125 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/anthropics/antigravity-wrapper/internal/auth"
+	"github.com/anthropics/antigravity-wrapper/internal/executor"
+	"github.com/anthropics/antigravity-wrapper/internal/tokenizer"
+	"github.com/anthropics/antigravity-wrapper/internal/translator"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"github.com/tidwall/gjson"
+)
+
+// countTokensHandler handles Anthropic Messages API count_tokens requests.
+func (s *Server) countTokensHandler(c *gin.Context) {
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": gin.H{
+				"message": "Failed to read request body",
+				"type":    "invalid_request_error",
+			},
+		})
+		return
+	}
+
+	modelName := gjson.GetBytes(body, "model").String()
+	if modelName == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": gin.H{
+				"message": "model is required",
+				"type":    "invalid_request_error",
+			},
+		})
+		return
+	}
+
+	// Inline images and documents referenced by URL or file_id, so that they
+	// are counted like in the request itself
+	body, ok := s.inlineRemoteMedia(c, body)
+	if !ok {
+		return
+	}
+	payload := translator.ConvertClaudeRequestToAntigravity(modelName, body, false, &translator.TranslatorOptions{
+		Signatures: s.signatures,
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"input_tokens": s.countInputTokens(c.Request.Context(), s.countingCredentials(c, body), modelName, payload),
+	})
+}
+
+// responsesInputTokensHandler handles OpenAI Responses API input token
+// counting requests.
+func (s *Server) responsesInputTokensHandler(c *gin.Context) {
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": gin.H{
+				"message": "Failed to read request body",
+				"type":    "invalid_request_error",
+			},
+		})
+		return
+	}
+
+	modelName := gjson.GetBytes(body, "model").String()
+	if modelName == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": gin.H{
+				"message": "model is required",
+				"type":    "invalid_request_error",
+			},
+		})
+		return
+	}
+
+	body, ok := responsesMessages(c, body)
+	if !ok {
+		return
+	}
+	body, ok = s.inlineRemoteMedia(c, body)
+	if !ok {
+		return
+	}
+	payload := translator.ConvertOpenAIRequestToAntigravity(modelName, body, false)
+
+	c.JSON(http.StatusOK, gin.H{
+		"object":       "response.input_tokens",
+		"input_tokens": s.countInputTokens(c.Request.Context(), s.countingCredentials(c, body), modelName, payload),
+	})
+}
+
+// countingCredentials returns the account to count tokens with, or nil if
+// there is none. Counting does not advance the account rotation.
+func (s *Server) countingCredentials(c *gin.Context, body []byte) *auth.Credentials {
+	if !s.hasCredentials() {
+		return nil
+	}
+	return s.peekCredentials(c, resolveSessionKey(c, body))
+}
+
+// countInputTokens returns the input tokens of an Antigravity request. The
+// upstream countTokens method is used when credentials are available and it is
+// supported; otherwise the count is estimated locally.
+func (s *Server) countInputTokens(ctx context.Context, creds *auth.Credentials, modelName string, payload []byte) int64 {
+	if creds != nil {
+		count, err := s.executor.CountTokens(ctx, creds, executor.Request{
+			Model:   modelName,
+			Payload: payload,
+		})
+		if err == nil {
+			// Tool declarations are not counted upstream
+			return count + int64(tokenizer.EstimateTools(gjson.GetBytes(payload, "request.tools")))
+		}
+		if !errors.Is(err, executor.ErrCountTokensUnsupported) {
+			log.Debugf("Upstream token count failed, estimating locally: %v", err)
+		}
+	}
+	return int64(tokenizer.EstimateRequest(payload))
+}
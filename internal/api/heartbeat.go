@@ -0,0 +1,124 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/anthropics/antigravity-wrapper/internal/auth"
+	"github.com/anthropics/antigravity-wrapper/internal/executor"
+	"github.com/gin-gonic/gin"
+)
+
+// heartbeat signals when a stream has been silent for the configured interval,
+// so that handlers can keep the downstream connection alive.
+type heartbeat struct {
+	interval time.Duration
+	ticker   *time.Ticker
+}
+
+// newHeartbeat creates a heartbeat using the configured interval. A disabled
+// heartbeat never fires.
+func (s *Server) newHeartbeat() *heartbeat {
+	h := &heartbeat{interval: time.Duration(s.cfg.HeartbeatInterval) * time.Second}
+	if h.interval > 0 {
+		h.ticker = time.NewTicker(h.interval)
+	}
+	return h
+}
+
+// C returns the channel on which heartbeats are delivered.
+func (h *heartbeat) C() <-chan time.Time {
+	if h.ticker == nil {
+		return nil
+	}
+	return h.ticker.C
+}
+
+// Reset restarts the silence interval after the stream has written data.
+func (h *heartbeat) Reset() {
+	if h.ticker != nil {
+		h.ticker.Reset(h.interval)
+	}
+}
+
+// Stop releases the heartbeat's resources.
+func (h *heartbeat) Stop() {
+	if h.ticker != nil {
+		h.ticker.Stop()
+	}
+}
+
+// streamStart is the outcome of a streaming upstream call.
+type streamStart struct {
+	chunks <-chan executor.StreamChunk
+	err    error
+}
+
+// openStream sets the SSE headers, starts the heartbeat and then makes the
+// streaming upstream call, sending ping while the upstream has not answered
+// yet. Waiting for the upstream's response headers can take long, e.g. while
+// it retries, and the keepalives stop proxies and clients from timing out the
+// connection meanwhile. The heartbeat keeps running for the rest of the stream
+// and must be stopped by the caller. If the call fails, the heartbeat is
+// stopped and the error is reported by writeStreamError.
+func (s *Server) openStream(c *gin.Context, creds *auth.Credentials, req executor.Request, ping func() string) (<-chan executor.StreamChunk, *heartbeat, error) {
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+
+	// The call may outlive the handler if the client disconnects, so it must
+	// not use c
+	call := newStreamCall(c)
+	heartbeat := s.newHeartbeat()
+	started := make(chan streamStart, 1)
+	go func() {
+		chunks, err := s.executeStream(call, creds, req)
+		started <- streamStart{chunks: chunks, err: err}
+	}()
+
+	for {
+		select {
+		case start := <-started:
+			if start.err != nil {
+				heartbeat.Stop()
+				return nil, nil, start.err
+			}
+			heartbeat.Reset()
+			return start.chunks, heartbeat, nil
+		case <-heartbeat.C():
+			c.Writer.WriteString(ping())
+			c.Writer.Flush()
+		case <-call.ctx.Done():
+			heartbeat.Stop()
+			// Drain so the upstream reader can finish
+			go func() {
+				if start := <-started; start.chunks != nil {
+					for range start.chunks {
+					}
+				}
+			}()
+			return nil, nil, call.ctx.Err()
+		}
+	}
+}
+
+// writeStreamError reports a failed streaming upstream call. If nothing was
+// sent yet the error is returned with a status code, otherwise the stream has
+// already started and the error is sent as event.
+func writeStreamError(c *gin.Context, err error, event string) {
+	if c.Writer.Written() {
+		c.Writer.WriteString(event)
+		c.Writer.Flush()
+		return
+	}
+
+	c.Writer.Header().Del("Content-Type")
+	c.Writer.Header().Del("Cache-Control")
+	c.Writer.Header().Del("Connection")
+	c.JSON(http.StatusInternalServerError, gin.H{
+		"error": gin.H{
+			"message": err.Error(),
+			"type":    "api_error",
+		},
+	})
+}
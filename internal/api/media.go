@@ -0,0 +1,134 @@
+package api
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/anthropics/antigravity-wrapper/internal/config"
+	"github.com/anthropics/antigravity-wrapper/internal/media"
+	"github.com/anthropics/antigravity-wrapper/internal/responsecache"
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// Remote images of up to mediaCacheMaxBytes are cached in memory for an hour,
+// up to mediaCacheEntries, which bounds the cache to about 85 MB.
+const (
+	mediaCacheTTL      = time.Hour
+	mediaCacheEntries  = 64
+	mediaCacheMaxBytes = 1 << 20
+)
+
+// newMediaFetcher creates the fetcher for remote image and document URLs in
+// requests.
+func newMediaFetcher(cfg *config.Config) *media.Fetcher {
+	return media.NewFetcher(media.Options{
+		MaxBytes:      int64(cfg.MediaMaxSize) << 20,
+		Timeout:       time.Duration(cfg.MediaTimeout) * time.Second,
+		AllowPrivate:  cfg.MediaAllowPrivate,
+		CacheMaxBytes: mediaCacheMaxBytes,
+	}, responsecache.NewMemoryStore(mediaCacheTTL, mediaCacheEntries))
+}
+
+// inlineRemoteMedia replaces the images and documents that an OpenAI or Claude
+// request references by http(s) URL or Files API file_id with inline data, so
+// that the translators only see base64 media. It covers message content and
+// the content of Claude tool results. Inline input_audio is checked against
+// the configured audio limits. When media cannot be resolved or is invalid it
+// responds with 400 and returns false.
+func (s *Server) inlineRemoteMedia(c *gin.Context, body []byte) ([]byte, bool) {
+	var err error
+	gjson.GetBytes(body, "messages").ForEach(func(i, message gjson.Result) bool {
+		message.Get("content").ForEach(func(j, block gjson.Result) bool {
+			path := "messages." + strconv.Itoa(int(i.Int())) + ".content." + strconv.Itoa(int(j.Int()))
+			if body, err = s.inlineRemoteBlock(c, body, path, block); err != nil {
+				return false
+			}
+			block.Get("content").ForEach(func(k, nested gjson.Result) bool {
+				body, err = s.inlineRemoteBlock(c, body, path+".content."+strconv.Itoa(int(k.Int())), nested)
+				return err == nil
+			})
+			return err == nil
+		})
+		return err == nil
+	})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": gin.H{
+				"message": err.Error(),
+				"type":    "invalid_request_error",
+			},
+		})
+		return nil, false
+	}
+	return body, true
+}
+
+// inlineRemoteBlock replaces the content block at path with inline data if it
+// references an image or document by remote URL or file_id.
+func (s *Server) inlineRemoteBlock(c *gin.Context, body []byte, path string, block gjson.Result) ([]byte, error) {
+	switch {
+	case block.Get("type").String() == "image_url" && media.IsRemote(block.Get("image_url.url").String()):
+		mimeType, data, err := s.media.FetchImage(c.Request.Context(), block.Get("image_url.url").String())
+		if err != nil {
+			return body, err
+		}
+		return sjson.SetBytes(body, path+".image_url.url", "data:"+mimeType+";base64,"+data)
+	case block.Get("type").String() == "image" && block.Get("source.type").String() == "url":
+		mimeType, data, err := s.media.FetchImage(c.Request.Context(), block.Get("source.url").String())
+		if err != nil {
+			return body, err
+		}
+		source := map[string]string{"type": "base64", "media_type": mimeType, "data": data}
+		return sjson.SetBytes(body, path+".source", source)
+	case block.Get("type").String() == "document" && block.Get("source.type").String() == "url":
+		mimeType, data, err := s.media.FetchDocument(c.Request.Context(), block.Get("source.url").String())
+		if err != nil {
+			return body, err
+		}
+		source := map[string]string{"type": "base64", "media_type": mimeType, "data": data}
+		return sjson.SetBytes(body, path+".source", source)
+	case block.Get("type").String() == "file" && block.Get("file.file_id").String() != "" && !block.Get("file.file_data").Exists():
+		mimeType, data, err := s.uploadedFile(c, block.Get("file.file_id").String())
+		if err != nil {
+			return body, err
+		}
+		return sjson.SetBytes(body, path+".file.file_data", "data:"+mimeType+";base64,"+data)
+	case block.Get("type").String() == "input_audio":
+		data, err := base64.StdEncoding.DecodeString(block.Get("input_audio.data").String())
+		if err != nil {
+			return body, fmt.Errorf("invalid input_audio at %s: data is not valid base64", path)
+		}
+		maxBytes := int64(s.cfg.AudioMaxSize) << 20
+		maxDuration := time.Duration(s.cfg.AudioMaxDuration) * time.Second
+		if err := media.CheckAudio(block.Get("input_audio.format").String(), data, maxBytes, maxDuration); err != nil {
+			return body, fmt.Errorf("invalid input_audio at %s: %w", path, err)
+		}
+		return body, nil
+	case (block.Get("type").String() == "image" || block.Get("type").String() == "document") && block.Get("source.type").String() == "file":
+		mimeType, data, err := s.uploadedFile(c, block.Get("source.file_id").String())
+		if err != nil {
+			return body, err
+		}
+		source := map[string]string{"type": "base64", "media_type": mimeType, "data": data}
+		return sjson.SetBytes(body, path+".source", source)
+	}
+	return body, nil
+}
+
+// uploadedFile returns the MIME type and base64-encoded content of a file
+// uploaded through the Files API by the request's API key.
+func (s *Server) uploadedFile(c *gin.Context, id string) (mimeType, data string, err error) {
+	if s.files == nil {
+		return "", "", fmt.Errorf("file %q cannot be resolved: the Files API requires data_dir to be configured", id)
+	}
+	file, content, err := s.files.Content(extractAPIKey(c), id)
+	if err != nil {
+		return "", "", fmt.Errorf("file %q: %w", id, err)
+	}
+	return file.MIMEType, base64.StdEncoding.EncodeToString(content), nil
+}
@@ -2,17 +2,21 @@ package api
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
+	"math"
 	"net/http"
 	"slices"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/anthropics/antigravity-wrapper/internal/executor"
+	"github.com/anthropics/antigravity-wrapper/internal/ratelimit"
 	"github.com/gin-gonic/gin"
 	log "github.com/sirupsen/logrus"
 	"github.com/tidwall/gjson"
-	"golang.org/x/time/rate"
 )
 
 // corsMiddleware returns middleware that handles CORS (Cross-Origin Resource Sharing).
@@ -29,7 +33,7 @@ func corsMiddleware() gin.HandlerFunc {
 
 		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
 		c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-API-Key, X-Requested-With")
+		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-API-Key, X-Requested-With, X-Session-Id")
 		c.Writer.Header().Set("Access-Control-Max-Age", "86400")
 
 		// Handle preflight OPTIONS request
@@ -96,34 +100,32 @@ func (s *Server) apiKeyAuth() gin.HandlerFunc {
 	}
 }
 
-// rateLimitMiddleware returns middleware that performs rate limiting.
+// rateLimitMiddleware returns middleware that enforces per-key request and token
+// budgets. It must run after apiKeyAuth so that invalid keys do not consume budget.
 func (s *Server) rateLimitMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		limit := s.cfg.RateLimit
-		key := extractAPIKey(c)
-
-		// Check for per-key rate limit
-		if key != "" && s.keyStore != nil {
-			if apiKey := s.keyStore.Get(key); apiKey != nil && apiKey.RateLimit > 0 {
-				limit = apiKey.RateLimit
-			}
-		}
-
-		if limit <= 0 {
+		key, limits := s.rateLimitFor(c)
+		if limits.RPM <= 0 && limits.TPM <= 0 {
 			c.Next()
 			return
 		}
 
-		if key == "" {
-			key = c.ClientIP()
+		status, err := s.rateLimiter.Allow(c.Request.Context(), key, limits)
+		if err != nil {
+			// Fail open so that a store outage does not take the API down
+			log.Warnf("Rate limit check failed: %v", err)
+			c.Next()
+			return
 		}
 
-		// Get or create limiter for this key
-		// limiters is a sync.Map storing *rate.Limiter
-		val, _ := s.limiters.LoadOrStore(key, rate.NewLimiter(rate.Every(time.Minute/time.Duration(limit)), limit))
-		limiter := val.(*rate.Limiter)
+		writeRateLimitHeaders(c, status)
 
-		if !limiter.Allow() {
+		if !status.Allowed {
+			reset := status.RequestReset
+			if status.TokenLimit > 0 && status.TokenRemaining == 0 && status.TokenReset.After(reset) {
+				reset = status.TokenReset
+			}
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(time.Until(reset).Seconds()))))
 			c.JSON(http.StatusTooManyRequests, gin.H{
 				"error": gin.H{
 					"message": "Rate limit exceeded. Please try again later.",
@@ -137,6 +139,67 @@ func (s *Server) rateLimitMiddleware() gin.HandlerFunc {
 	}
 }
 
+// rateLimitFor returns the rate limit key and limits that apply to the request.
+func (s *Server) rateLimitFor(c *gin.Context) (string, ratelimit.Limits) {
+	limits := ratelimit.Limits{RPM: s.cfg.RateLimit, TPM: s.cfg.TokenRateLimit}
+
+	// Check for per-key limits
+	if keyData := s.lookupKey(c); keyData != nil {
+		if keyData.RateLimit > 0 {
+			limits.RPM = keyData.RateLimit
+		}
+		if keyData.TokenRateLimit > 0 {
+			limits.TPM = keyData.TokenRateLimit
+		}
+	}
+
+	key := extractAPIKey(c)
+	if key == "" {
+		key = c.ClientIP()
+	}
+	return key, limits
+}
+
+// tokenUsageRecorder returns an executor usage callback that charges the tokens
+// used by the request to its token budget, or nil if no token limit applies.
+func (s *Server) tokenUsageRecorder(c *gin.Context) func(executor.UsageDetail) {
+	key, limits := s.rateLimitFor(c)
+	if limits.TPM <= 0 {
+		return nil
+	}
+	return func(usage executor.UsageDetail) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := s.rateLimiter.RecordTokens(ctx, key, usage.TotalTokens); err != nil {
+			log.Warnf("Failed to record token usage: %v", err)
+		}
+	}
+}
+
+// writeRateLimitHeaders emits rate limit headers in the style of the API being
+// served: anthropic-ratelimit-* for the Messages API, x-ratelimit-* otherwise.
+func writeRateLimitHeaders(c *gin.Context, status ratelimit.Status) {
+	anthropic := strings.HasPrefix(c.Request.URL.Path, "/v1/messages")
+
+	write := func(kind string, limit, remaining int64, reset time.Time) {
+		if limit <= 0 {
+			return
+		}
+		if anthropic {
+			c.Header("anthropic-ratelimit-"+kind+"-limit", strconv.FormatInt(limit, 10))
+			c.Header("anthropic-ratelimit-"+kind+"-remaining", strconv.FormatInt(remaining, 10))
+			c.Header("anthropic-ratelimit-"+kind+"-reset", reset.UTC().Format(time.RFC3339))
+			return
+		}
+		c.Header("x-ratelimit-limit-"+kind, strconv.FormatInt(limit, 10))
+		c.Header("x-ratelimit-remaining-"+kind, strconv.FormatInt(remaining, 10))
+		c.Header("x-ratelimit-reset-"+kind, time.Until(reset).Round(time.Second).String())
+	}
+
+	write("requests", status.RequestLimit, status.RequestRemaining, status.RequestReset)
+	write("tokens", status.TokenLimit, status.TokenRemaining, status.TokenReset)
+}
+
 // modelAccessMiddleware returns middleware that validates model access for API keys.
 func (s *Server) modelAccessMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -0,0 +1,176 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/anthropics/antigravity-wrapper/internal/auth"
+	"github.com/anthropics/antigravity-wrapper/internal/config"
+	"github.com/anthropics/antigravity-wrapper/internal/executor"
+	"github.com/anthropics/antigravity-wrapper/internal/metrics"
+	"github.com/anthropics/antigravity-wrapper/internal/responsecache"
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+)
+
+// responseCacheHeader reports whether a response was served from the cache.
+const responseCacheHeader = "X-Response-Cache"
+
+// newResponseCache creates the response cache store selected by the config.
+func newResponseCache(cfg *config.Config) (responsecache.Store, error) {
+	ttl := time.Duration(cfg.ResponseCacheTTL) * time.Second
+	switch cfg.ResponseCacheBackend {
+	case "", "memory":
+		return responsecache.NewMemoryStore(ttl, cfg.ResponseCacheMaxEntries), nil
+	case "disk":
+		return responsecache.NewDiskStore(filepath.Join(cfg.DataDir, "response_cache"), ttl, cfg.ResponseCacheMaxEntries)
+	default:
+		return nil, fmt.Errorf("unsupported response cache backend: %s", cfg.ResponseCacheBackend)
+	}
+}
+
+// Context keys holding the response cache key of a request and its cached
+// response, set by lookupResponseCache.
+const (
+	responseCacheKeyContext = "responseCacheKey"
+	cachedResponseContext   = "cachedResponse"
+)
+
+// responseCacheKey returns the cache key for a request, or "" if the response
+// cache does not apply to it. Entries are scoped to the API key, so that
+// clients never see each other's responses.
+func (s *Server) responseCacheKey(c *gin.Context, modelName string, payload []byte) string {
+	enabled := s.cfg.ResponseCache
+	if keyData := s.lookupKey(c); keyData != nil && keyData.ResponseCache != nil {
+		enabled = *keyData.ResponseCache
+	}
+	if !enabled || !responsecache.Cacheable(payload) {
+		return ""
+	}
+	return responsecache.Key(extractAPIKey(c), modelName, payload)
+}
+
+// lookupResponseCache looks up a translated request in the response cache and
+// reports whether it was found. It runs before an account, a concurrency slot
+// and a context window check are taken for the request, as a cached response
+// needs none of them. execute and executeStream then serve the cached response,
+// or store the upstream response under the request's key.
+func (s *Server) lookupResponseCache(c *gin.Context, modelName string, payload []byte) bool {
+	key := s.responseCacheKey(c, modelName, payload)
+	if key == "" {
+		return false
+	}
+	c.Set(responseCacheKeyContext, key)
+
+	if body, ok := s.responseCache.Get(key); ok {
+		c.Set(cachedResponseContext, body)
+		recordResponseCache(c, "hit")
+		return true
+	}
+	recordResponseCache(c, "miss")
+	return false
+}
+
+// execute performs a non-streaming request, serving it from the response cache
+// when lookupResponseCache found it.
+func (s *Server) execute(c *gin.Context, creds *auth.Credentials, req executor.Request) (*executor.Response, error) {
+	if body, ok := c.Get(cachedResponseContext); ok {
+		return &executor.Response{StatusCode: 200, Body: body.([]byte)}, nil
+	}
+
+	resp, err := s.executor.Execute(c.Request.Context(), creds, req)
+	if key := c.GetString(responseCacheKeyContext); key != "" && err == nil && isCompleteResponse(resp.Body) {
+		s.responseCache.Set(key, resp.Body)
+	}
+	return resp, err
+}
+
+// streamCall holds what a streaming request needs from its gin context. gin
+// reuses the context once the handler returns, so goroutines that outlive the
+// handler use a streamCall instead.
+type streamCall struct {
+	ctx    context.Context
+	key    string // Response cache key, "" if the cache does not apply
+	cached []byte // Cached response found by lookupResponseCache
+}
+
+// newStreamCall captures the streaming request of c.
+func newStreamCall(c *gin.Context) streamCall {
+	call := streamCall{
+		ctx: c.Request.Context(),
+		key: c.GetString(responseCacheKeyContext),
+	}
+	if body, ok := c.Get(cachedResponseContext); ok {
+		call.cached = body.([]byte)
+	}
+	return call
+}
+
+// executeStream performs a streaming request, serving it from the response
+// cache when lookupResponseCache found it. Cached responses are replayed as a
+// single chunk, and completed streams are stored as the equivalent
+// non-streaming response.
+func (s *Server) executeStream(call streamCall, creds *auth.Credentials, req executor.Request) (<-chan executor.StreamChunk, error) {
+	if call.cached != nil {
+		out := make(chan executor.StreamChunk, 1)
+		out <- executor.StreamChunk{Data: call.cached}
+		close(out)
+		return out, nil
+	}
+
+	key := call.key
+	if key == "" {
+		return s.executor.ExecuteStream(call.ctx, creds, req)
+	}
+
+	upstream, err := s.executor.ExecuteStream(call.ctx, creds, req)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := call.ctx
+	out := make(chan executor.StreamChunk)
+	go func() {
+		defer close(out)
+
+		var chunks [][]byte
+		failed := false
+		for chunk := range upstream {
+			if chunk.Err != nil {
+				failed = true
+			} else {
+				chunks = append(chunks, chunk.Data)
+			}
+
+			select {
+			case out <- chunk:
+			case <-ctx.Done():
+				// Drain so the upstream reader can finish
+				for range upstream {
+				}
+				return
+			}
+		}
+
+		if !failed && len(chunks) > 0 {
+			if merged := responsecache.MergeStream(chunks); isCompleteResponse(merged) {
+				s.responseCache.Set(key, merged)
+			}
+		}
+	}()
+	return out, nil
+}
+
+// isCompleteResponse reports whether an upstream response finished, so that
+// truncated or failed responses are never cached.
+func isCompleteResponse(body []byte) bool {
+	return gjson.GetBytes(body, "response.candidates.0.finishReason").String() != ""
+}
+
+// recordResponseCache reports a cache lookup in the response headers and metrics.
+func recordResponseCache(c *gin.Context, result string) {
+	c.Header(responseCacheHeader, result)
+	metrics.Default().AddCounter("antigravity_response_cache_requests_total", "Response cache lookups by result.", metrics.Labels{"result": result}, 1)
+}
@@ -0,0 +1,36 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// applySafety sets the safety settings of a translated request from the API
+// key's safety policy, or the configured one for the model, and from the
+// client's safety_settings when the policy allows them.
+func (s *Server) applySafety(c *gin.Context, modelName string, body, payload []byte) ([]byte, bool) {
+	policy := s.cfg.Safety
+	if modelPolicy, ok := s.cfg.ModelSafety[modelName]; ok {
+		policy = modelPolicy
+	}
+	if keyData := s.lookupKey(c); keyData != nil && keyData.Safety != nil {
+		policy = *keyData.Safety
+	}
+
+	settings, err := policy.Settings(gjson.GetBytes(body, "safety_settings"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": gin.H{
+				"message": err.Error(),
+				"type":    "invalid_request_error",
+			},
+		})
+		return nil, false
+	}
+
+	payload, _ = sjson.SetBytes(payload, "request.safetySettings", settings)
+	return payload, true
+}
@@ -3,14 +3,29 @@ package api
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io/fs"
 	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
 	"sync"
 	"time"
 
 	"github.com/anthropics/antigravity-wrapper/internal/auth"
+	"github.com/anthropics/antigravity-wrapper/internal/concurrency"
 	"github.com/anthropics/antigravity-wrapper/internal/config"
+	"github.com/anthropics/antigravity-wrapper/internal/contextwindow"
 	"github.com/anthropics/antigravity-wrapper/internal/executor"
+	"github.com/anthropics/antigravity-wrapper/internal/files"
+	"github.com/anthropics/antigravity-wrapper/internal/media"
+	"github.com/anthropics/antigravity-wrapper/internal/ratelimit"
+	"github.com/anthropics/antigravity-wrapper/internal/responsecache"
+	"github.com/anthropics/antigravity-wrapper/internal/thoughtsig"
 	"github.com/gin-gonic/gin"
 	log "github.com/sirupsen/logrus"
 )
@@ -25,8 +40,18 @@ type Server struct {
 	store          *auth.Store
 	credentials    *auth.Credentials
 	accountManager *auth.AccountManager
+	accountsMu     sync.RWMutex
+	oauthFlow      *auth.OAuthFlow
+	sessions       *sessionAffinity
+	limiter        *concurrency.Limiter
 	keyStore       *auth.KeyStore
-	limiters       sync.Map
+	rateLimiter    *ratelimit.Limiter
+
+	responseCache   responsecache.Store
+	contextStrategy contextwindow.Strategy
+	signatures      *thoughtsig.Signer
+	media           *media.Fetcher
+	files           *files.Store
 }
 
 // NewServer creates a new API server instance.
@@ -45,19 +70,51 @@ func NewServer(cfg *config.Config) (*Server, error) {
 		return nil, fmt.Errorf("create data directory: %w", err)
 	}
 
-	// Initialize KeyStore
+	// Initialize KeyStore and the Files API store
 	var keyStore *auth.KeyStore
+	var fileStore *files.Store
 	if cfg.DataDir != "" {
 		var err error
 		keyStore, err = auth.NewKeyStore(cfg.DataDir)
 		if err != nil {
 			return nil, fmt.Errorf("initialize key store: %w", err)
 		}
+		fileStore, err = files.NewStore(filepath.Join(cfg.DataDir, "files"), int64(cfg.FilesMaxSize)<<20)
+		if err != nil {
+			return nil, fmt.Errorf("initialize file store: %w", err)
+		}
 	}
 
 	store := auth.NewStore(cfg.CredentialsDir)
 	tokenManager := auth.NewTokenManager(store, executor.NewHTTPClient(cfg.ProxyURL, 30*time.Second))
 	exec := executor.NewExecutor(cfg.ProxyURL, tokenManager)
+	authenticator := auth.NewAuthenticator(store, executor.NewHTTPClient(cfg.ProxyURL, 30*time.Second))
+	rateLimitStore, err := newRateLimitStore(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("initialize rate limit store: %w", err)
+	}
+	responseCache, err := newResponseCache(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("initialize response cache: %w", err)
+	}
+	contextStrategy, err := contextwindow.ParseStrategy(cfg.ContextStrategy)
+	if err != nil {
+		return nil, err
+	}
+	if err := cfg.Safety.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid safety policy: %w", err)
+	}
+	for model, policy := range cfg.ModelSafety {
+		if err := policy.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid safety policy for %s: %w", model, err)
+		}
+	}
+	signatureSecret, err := loadSignatureSecret(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("initialize signature secret: %w", err)
+	}
+	limiter := concurrency.NewLimiter(cfg.MaxConcurrency, cfg.MaxConcurrencyPerAccount,
+		cfg.MaxQueueSize, time.Duration(cfg.QueueTimeout)*time.Second)
 
 	s := &Server{
 		cfg:          cfg,
@@ -65,17 +122,25 @@ func NewServer(cfg *config.Config) (*Server, error) {
 		executor:     exec,
 		tokenManager: tokenManager,
 		store:        store,
+		oauthFlow:    auth.NewOAuthFlow(authenticator),
+		sessions:     newSessionAffinity(sessionAffinityTTL),
+		limiter:      limiter,
 		keyStore:     keyStore,
+		rateLimiter:  ratelimit.New(rateLimitStore),
+
+		responseCache:   responseCache,
+		contextStrategy: contextStrategy,
+		signatures:      thoughtsig.New(signatureSecret),
+		media:           newMediaFetcher(cfg),
+		files:           fileStore,
 	}
 
 	// Apply global middlewares
 	engine.Use(corsMiddleware())
 	engine.Use(requestLogger())
-	// Always enable rate limit middleware to support per-key limits
-	engine.Use(s.rateLimitMiddleware())
 
 	// Try to load AccountManager for round-robin (priority)
-	if accountManager := auth.LoadAccountManager(tokenManager); accountManager != nil {
+	if accountManager := auth.LoadAccountManager(auth.AccountsPath(cfg.CredentialsDir), tokenManager); accountManager != nil {
 		s.accountManager = accountManager
 		log.Infof("Round-robin mode enabled with %d accounts", accountManager.Count())
 	} else {
@@ -95,30 +160,241 @@ func NewServer(cfg *config.Config) (*Server, error) {
 	return s, nil
 }
 
+// newRateLimitStore creates the rate limit counter store selected by the config.
+func newRateLimitStore(cfg *config.Config) (ratelimit.Store, error) {
+	switch cfg.RateLimitBackend {
+	case "", "memory":
+		return ratelimit.NewMemoryStore(), nil
+	case "redis":
+		if cfg.RateLimitRedis == "" {
+			return nil, fmt.Errorf("rate_limit_redis is required for the redis backend")
+		}
+		log.Infof("Using shared rate limit store at %s", cfg.RateLimitRedis)
+		return ratelimit.NewRedisStore(cfg.RateLimitRedis)
+	default:
+		return nil, fmt.Errorf("unsupported rate limit backend: %s", cfg.RateLimitBackend)
+	}
+}
+
+// loadSignatureSecret returns the key for thought signature envelopes. Without
+// a configured signature_secret, a key is generated once and kept in the data
+// directory, so that signatures survive restarts and verify on replicas sharing
+// it. Without a data directory, the signer uses a random key per process.
+func loadSignatureSecret(cfg *config.Config) (string, error) {
+	if cfg.SignatureSecret != "" {
+		return cfg.SignatureSecret, nil
+	}
+	if cfg.DataDir == "" {
+		log.Warn("No signature_secret or data_dir configured; thought signatures will not verify after a restart or on other replicas")
+		return "", nil
+	}
+
+	path := filepath.Join(cfg.DataDir, "signature_secret")
+	data, err := os.ReadFile(path)
+	if err == nil && len(data) > 0 {
+		return string(data), nil
+	}
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return "", err
+	}
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	secret := hex.EncodeToString(key)
+	if err := os.WriteFile(path, []byte(secret), 0600); err != nil {
+		return "", err
+	}
+	log.Infof("Generated a signature secret in %s; set signature_secret to the same value on replicas that do not share the data directory", path)
+	return secret, nil
+}
+
 // getNextCredentials returns the next credentials to use for a request.
-// If AccountManager is available, uses round-robin selection.
-// Otherwise, returns the single stored credentials.
-func (s *Server) getNextCredentials() *auth.Credentials {
-	if s.accountManager != nil {
-		creds, err := s.accountManager.Next()
-		if err != nil {
-			log.Errorf("Failed to get next account: %v", err)
-			return s.credentials // Fall back to single credentials if available
+// If AccountManager is available, a conversation identified by sessionKey stays
+// on the account it was first served by; otherwise uses round-robin selection
+// within the account group of the request's API key, falling back to the shared
+// pool when the key allows it. Without an AccountManager, returns the single
+// stored credentials. Returns nil if no account may serve the request.
+func (s *Server) getNextCredentials(c *gin.Context, sessionKey string) *auth.Credentials {
+	return s.selectCredentials(c, sessionKey, true)
+}
+
+// peekCredentials returns the account a request would be served by without
+// advancing the round-robin rotation or pinning a session, for requests such
+// as token counting that do not generate content.
+func (s *Server) peekCredentials(c *gin.Context, sessionKey string) *auth.Credentials {
+	return s.selectCredentials(c, sessionKey, false)
+}
+
+// selectCredentials picks the account for a request. With advance set, the
+// rotation moves on and the session is pinned to the chosen account.
+func (s *Server) selectCredentials(c *gin.Context, sessionKey string, advance bool) *auth.Credentials {
+	group, sharedFallback := "", false
+	if keyData := s.lookupKey(c); keyData != nil {
+		group, sharedFallback = keyData.AccountGroup, keyData.SharedFallback
+	}
+
+	accountManager := s.accounts()
+	if accountManager == nil {
+		if group != "" && !sharedFallback {
+			return nil
+		}
+		return s.credentials
+	}
+
+	// Reuse the pinned account while it is still allowed for this key
+	if sessionKey != "" {
+		if email, ok := s.sessions.Account(sessionKey); ok {
+			if creds, accountGroup, ok := accountManager.Get(email); ok &&
+				(accountGroup == group || (sharedFallback && accountGroup == "")) {
+				log.Debugf("Using pinned account %s for session", email)
+				return creds
+			}
+		}
+	}
+
+	next := accountManager.NextInGroup
+	if !advance {
+		next = accountManager.PeekInGroup
+	}
+	creds, err := next(group)
+	if err != nil && group != "" && sharedFallback {
+		log.Debugf("Falling back to shared pool: %v", err)
+		creds, err = next("")
+	}
+	if err != nil {
+		log.Errorf("Failed to get next account: %v", err)
+		if group != "" && !sharedFallback {
+			return nil
 		}
-		return creds
+		return s.credentials // Fall back to single credentials if available
+	}
+
+	if advance && sessionKey != "" && creds.Email != "" {
+		s.sessions.Pin(sessionKey, creds.Email)
+	}
+	return creds
+}
+
+// admitRequest prepares a request for the upstream: it selects the account,
+// fits the payload into the model's context window and takes a concurrency
+// slot. If the request cannot be served, an error response is written and
+// false is returned. Otherwise release must be called once the upstream call
+// completes.
+func (s *Server) admitRequest(c *gin.Context, modelName string, payload []byte, sessionKey string) (creds *auth.Credentials, fitted []byte, release func(), ok bool) {
+	creds = s.getNextCredentials(c, sessionKey)
+	if creds == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error": gin.H{
+				"message": "No accounts available for this API key",
+				"type":    "api_error",
+			},
+		})
+		return nil, nil, nil, false
+	}
+
+	// Make sure the conversation fits the model before sending it upstream.
+	// This runs before taking a concurrency slot, as summarizing can take
+	// seconds
+	fitted, ok = s.fitContextWindow(c, modelName, payload, creds)
+	if !ok {
+		return nil, nil, nil, false
+	}
+
+	ticket, ok := s.acquireSlot(c, creds)
+	if !ok {
+		return nil, nil, nil, false
+	}
+	return creds, fitted, ticket.Release, true
+}
+
+// acquireSlot admits the request to the concurrency limiter for the account
+// serving it. If the request cannot be admitted, an error response is written
+// and false is returned. The returned ticket must be released once the
+// upstream call completes.
+func (s *Server) acquireSlot(c *gin.Context, creds *auth.Credentials) (*concurrency.Ticket, bool) {
+	priority := 0
+	if keyData := s.lookupKey(c); keyData != nil {
+		priority = keyData.Priority
+	}
+
+	ticket, err := s.limiter.Acquire(c.Request.Context(), creds.Email, priority)
+	if err != nil {
+		log.Warnf("Request not admitted for account %s: %v", creds.Email, err)
+		c.Header("Retry-After", "1")
+		c.JSON(http.StatusTooManyRequests, gin.H{
+			"error": gin.H{
+				"message": "Server is busy: " + err.Error(),
+				"type":    "rate_limit_error",
+			},
+		})
+		return nil, false
+	}
+
+	if s.limiter.Enabled() {
+		c.Header("X-Queue-Wait-Ms", strconv.FormatInt(ticket.Wait.Milliseconds(), 10))
+		c.Header("X-Queue-Depth", strconv.Itoa(ticket.QueueDepth))
+	}
+	return ticket, true
+}
+
+// lookupKey returns the stored settings for the request's API key, or nil for
+// config-based keys and unauthenticated requests.
+func (s *Server) lookupKey(c *gin.Context) *auth.APIKey {
+	if s.keyStore == nil {
+		return nil
+	}
+	apiKey := extractAPIKey(c)
+	if apiKey == "" || slices.Contains(s.cfg.APIKeys, apiKey) {
+		return nil
 	}
-	return s.credentials
+	return s.keyStore.Get(apiKey)
 }
 
 // hasCredentials returns true if any credentials are available.
 func (s *Server) hasCredentials() bool {
-	return s.accountManager != nil || s.credentials != nil
+	return s.accounts() != nil || s.credentials != nil
+}
+
+// accounts returns the account pool, or nil when running in single credential mode.
+func (s *Server) accounts() *auth.AccountManager {
+	s.accountsMu.RLock()
+	defer s.accountsMu.RUnlock()
+	return s.accountManager
+}
+
+// addAccount adds credentials to the account pool, switching from single
+// credential mode to round-robin mode if no pool is loaded yet.
+func (s *Server) addAccount(creds *auth.Credentials) error {
+	s.accountsMu.Lock()
+	defer s.accountsMu.Unlock()
+
+	if s.accountManager == nil {
+		manager := auth.NewAccountManager(auth.AccountsPath(s.cfg.CredentialsDir), s.tokenManager)
+		// Keep the existing single account in the new pool
+		if s.credentials != nil {
+			if err := manager.Add(s.credentials); err != nil {
+				return err
+			}
+		}
+		if err := manager.Add(creds); err != nil {
+			return err
+		}
+		s.accountManager = manager
+		log.Infof("Round-robin mode enabled with %d accounts", manager.Count())
+		return nil
+	}
+
+	return s.accountManager.Add(creds)
 }
 
 // setupRoutes configures all API routes.
 func (s *Server) setupRoutes() {
 	// API key authentication middleware
 	apiAuth := s.apiKeyAuth()
+	// Rate limiting runs after authentication so invalid keys don't consume budget
+	rateLimit := s.rateLimitMiddleware()
 
 	// Health check
 	s.engine.GET("/health", s.healthHandler)
@@ -132,20 +408,43 @@ func (s *Server) setupRoutes() {
 		admin.PUT("/keys/:key", s.updateKeyHandler)
 		admin.DELETE("/keys/:key", s.revokeKeyHandler)
 		admin.GET("/models", s.listModelsHandler)
+		admin.GET("/metrics", s.metricsHandler)
+		admin.GET("/accounts", s.listAccountsHandler)
+		admin.PUT("/accounts/:email", s.updateAccountHandler)
+		admin.POST("/accounts/oauth/start", s.startAccountOAuthHandler)
+		admin.POST("/accounts/oauth/complete", s.completeAccountOAuthHandler)
 	}
 
+	// OAuth callback for admin-driven account logins (validated by state)
+	s.engine.GET("/oauth-callback", s.oauthCallbackHandler)
+
 	// OpenAI-compatible endpoints
 	v1 := s.engine.Group("/v1")
 	v1.Use(apiAuth)
+	v1.Use(rateLimit)
 	v1.Use(s.modelAccessMiddleware())
 	{
 		v1.GET("/models", s.modelsHandler)
 		v1.POST("/chat/completions", s.chatCompletionsHandler)
 		v1.POST("/responses", s.responsesHandler)
+		v1.POST("/responses/input_tokens", s.responsesInputTokensHandler)
 	}
 
-	// Claude/Anthropic-compatible endpoint
-	s.engine.POST("/v1/messages", apiAuth, s.modelAccessMiddleware(), s.messagesHandler)
+	// Claude/Anthropic-compatible endpoints
+	s.engine.POST("/v1/messages", apiAuth, rateLimit, s.modelAccessMiddleware(), s.messagesHandler)
+	s.engine.POST("/v1/messages/count_tokens", apiAuth, rateLimit, s.modelAccessMiddleware(), s.countTokensHandler)
+
+	// Files API, shared by both formats
+	fileRoutes := s.engine.Group("/v1/files")
+	fileRoutes.Use(apiAuth)
+	fileRoutes.Use(rateLimit)
+	{
+		fileRoutes.POST("", s.uploadFileHandler)
+		fileRoutes.GET("", s.listFilesHandler)
+		fileRoutes.GET("/:id", s.getFileHandler)
+		fileRoutes.GET("/:id/content", s.fileContentHandler)
+		fileRoutes.DELETE("/:id", s.deleteFileHandler)
+	}
 }
 
 // Start begins listening for HTTP requests.
@@ -162,8 +461,8 @@ func (s *Server) Start() error {
 
 // Shutdown gracefully stops the server.
 func (s *Server) Shutdown(ctx context.Context) error {
-	if s.accountManager != nil {
-		if err := s.accountManager.SaveState(); err != nil {
+	if accountManager := s.accounts(); accountManager != nil {
+		if err := accountManager.SaveState(); err != nil {
 			log.Warnf("Failed to save account manager state: %v", err)
 		}
 	}
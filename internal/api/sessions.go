@@ -0,0 +1,152 @@
+package api
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/anthropics/antigravity-wrapper/internal/executor"
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+)
+
+// sessionAffinityTTL is how long an idle conversation stays pinned to its account.
+const sessionAffinityTTL = time.Hour
+
+// sessionHeader lets clients supply an explicit conversation identifier.
+const sessionHeader = "X-Session-Id"
+
+// sessionEntry records the account a conversation is pinned to.
+type sessionEntry struct {
+	email    string
+	lastUsed time.Time
+}
+
+// sessionAffinity pins conversations to accounts so that multi-turn
+// conversations keep thought signatures and upstream caching consistent.
+type sessionAffinity struct {
+	mu        sync.Mutex
+	entries   map[string]sessionEntry
+	ttl       time.Duration
+	lastPrune time.Time
+}
+
+// newSessionAffinity creates a new session affinity table.
+func newSessionAffinity(ttl time.Duration) *sessionAffinity {
+	return &sessionAffinity{
+		entries:   make(map[string]sessionEntry),
+		ttl:       ttl,
+		lastPrune: time.Now(),
+	}
+}
+
+// Account returns the account email pinned to the session, if any.
+func (a *sessionAffinity) Account(key string) (string, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	entry, ok := a.entries[key]
+	if !ok || time.Since(entry.lastUsed) > a.ttl {
+		return "", false
+	}
+	entry.lastUsed = time.Now()
+	a.entries[key] = entry
+	return entry.email, true
+}
+
+// Pin records the account email used for the session.
+func (a *sessionAffinity) Pin(key, email string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	now := time.Now()
+	a.entries[key] = sessionEntry{email: email, lastUsed: now}
+
+	// Evict idle sessions at most once per TTL period
+	if now.Sub(a.lastPrune) > a.ttl {
+		for k, entry := range a.entries {
+			if now.Sub(entry.lastUsed) > a.ttl {
+				delete(a.entries, k)
+			}
+		}
+		a.lastPrune = now
+	}
+}
+
+// resolveSessionKey derives a stable key for the conversation a request belongs
+// to. In order of preference it uses the X-Session-Id header, the Claude
+// metadata.user_id or OpenAI user field, or a hash of the conversation prefix
+// (system prompt up to and including the first user message). The key is
+// scoped to the API key. Returns "" if no key can be derived.
+func resolveSessionKey(c *gin.Context, body []byte) string {
+	source := ""
+	if v := c.GetHeader(sessionHeader); v != "" {
+		source = "header:" + v
+	} else if v := gjson.GetBytes(body, "metadata.user_id").String(); v != "" {
+		source = "user:" + v
+	} else if v := gjson.GetBytes(body, "user").String(); v != "" {
+		source = "user:" + v
+	} else if prefix := conversationPrefix(body); prefix != "" {
+		source = "prefix:" + prefix
+	}
+	if source == "" {
+		return ""
+	}
+
+	sum := sha256.Sum256([]byte(extractAPIKey(c) + "|" + source))
+	return hex.EncodeToString(sum[:])
+}
+
+// stableSessionID returns the upstream session ID for a session key, or "" to
+// let the executor generate a random one.
+func stableSessionID(sessionKey string) string {
+	if sessionKey == "" {
+		return ""
+	}
+	return executor.StableSessionID(sessionKey)
+}
+
+// conversationPrefix returns the compacted JSON of the parts of a request that
+// stay identical across turns of the same conversation.
+func conversationPrefix(body []byte) string {
+	var prefix bytes.Buffer
+	for _, path := range []string{"system", "instructions"} {
+		if v := gjson.GetBytes(body, path); v.Exists() {
+			prefix.WriteString(compactJSON(v.Raw))
+		}
+	}
+
+	messages := gjson.GetBytes(body, "messages")
+	if !messages.IsArray() {
+		messages = gjson.GetBytes(body, "input")
+	}
+	if messages.Type == gjson.String {
+		// A plain string input is a single-turn request
+		return ""
+	}
+
+	foundUser := false
+	for _, m := range messages.Array() {
+		prefix.WriteString(compactJSON(m.Raw))
+		if m.Get("role").String() == "user" {
+			foundUser = true
+			break
+		}
+	}
+	if !foundUser {
+		return ""
+	}
+	return prefix.String()
+}
+
+// compactJSON strips insignificant whitespace so re-serialized requests hash the same.
+func compactJSON(raw string) string {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, []byte(raw)); err != nil {
+		return raw
+	}
+	return buf.String()
+}
@@ -0,0 +1,33 @@
+package api
+
+import (
+	"strconv"
+
+	"github.com/anthropics/antigravity-wrapper/internal/models"
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+)
+
+// thinkingBudgetHeader reports the thinking budget applied to a request
+// (-1 = dynamic, 0 = disabled).
+const thinkingBudgetHeader = "X-Thinking-Budget"
+
+// applyThinking completes the thinking config of a translated request. Explicit
+// client settings win, then the API key's default, then the configured
+// per-model default, then the built-in default.
+func (s *Server) applyThinking(c *gin.Context, modelName string, payload []byte) []byte {
+	defaultBudget := models.BuiltinThinkingBudget(modelName)
+	if budget, ok := s.cfg.ThinkingBudgets[modelName]; ok {
+		defaultBudget = budget
+	}
+	if keyData := s.lookupKey(c); keyData != nil && keyData.ThinkingBudget != nil {
+		defaultBudget = *keyData.ThinkingBudget
+	}
+
+	payload = models.ApplyDefaultThinkingIfNeeded(modelName, payload, defaultBudget)
+	payload = models.StripThinkingConfigIfUnsupported(modelName, payload)
+	if budget := gjson.GetBytes(payload, "request.generationConfig.thinkingConfig.thinkingBudget"); budget.Exists() {
+		c.Header(thinkingBudgetHeader, strconv.FormatInt(budget.Int(), 10))
+	}
+	return payload
+}
@@ -19,6 +19,7 @@ type Account struct {
 	Timestamp    int64  `json:"timestamp"`
 	Expired      string `json:"expired"`
 	ProjectID    string `json:"project_id,omitempty"`
+	Group        string `json:"group,omitempty"` // Account group (empty = shared pool)
 }
 
 // AccountsFile represents the structure of accounts.json.
@@ -33,6 +34,7 @@ type AccountManager struct {
 	filePath     string
 	accounts     []Account
 	currentIndex int
+	groupIndex   map[string]int
 	tokenManager *TokenManager
 }
 
@@ -40,6 +42,7 @@ type AccountManager struct {
 func NewAccountManager(filePath string, tokenManager *TokenManager) *AccountManager {
 	return &AccountManager{
 		filePath:     filePath,
+		groupIndex:   make(map[string]int),
 		tokenManager: tokenManager,
 	}
 }
@@ -97,6 +100,95 @@ func (m *AccountManager) Next() (*Credentials, error) {
 	return creds, nil
 }
 
+// NextInGroup returns the next account in round-robin order among the accounts
+// assigned to group. An empty group selects the shared (ungrouped) accounts.
+func (m *AccountManager) NextInGroup(group string) (*Credentials, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n := len(m.accounts)
+	if n == 0 {
+		return nil, fmt.Errorf("no accounts available")
+	}
+
+	// The shared pool advances the persisted index; named groups keep their own cursor
+	cursor := m.currentIndex
+	if group != "" {
+		cursor = m.groupIndex[group] % n
+	}
+
+	for i := 0; i < n; i++ {
+		idx := (cursor + i) % n
+		account := m.accounts[idx]
+		if account.Group != group {
+			continue
+		}
+
+		if group == "" {
+			m.currentIndex = (idx + 1) % n
+		} else {
+			m.groupIndex[group] = (idx + 1) % n
+		}
+
+		log.Infof("Using account: %s (index: %d/%d, group: %q)", account.Email, idx, n, group)
+		return m.toCredentials(&account), nil
+	}
+
+	return nil, fmt.Errorf("no accounts in group %q", group)
+}
+
+// PeekInGroup returns the account that NextInGroup would return next, without
+// advancing the rotation.
+func (m *AccountManager) PeekInGroup(group string) (*Credentials, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n := len(m.accounts)
+	if n == 0 {
+		return nil, fmt.Errorf("no accounts available")
+	}
+
+	cursor := m.currentIndex
+	if group != "" {
+		cursor = m.groupIndex[group] % n
+	}
+	for i := 0; i < n; i++ {
+		account := m.accounts[(cursor+i)%n]
+		if account.Group == group {
+			return m.toCredentials(&account), nil
+		}
+	}
+
+	return nil, fmt.Errorf("no accounts in group %q", group)
+}
+
+// Get returns the credentials and group of the account with the given email.
+func (m *AccountManager) Get(email string) (*Credentials, string, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.accounts {
+		if m.accounts[i].Email == email {
+			return m.toCredentials(&m.accounts[i]), m.accounts[i].Group, true
+		}
+	}
+	return nil, "", false
+}
+
+// SetGroup assigns the account with the given email to group and persists the pool.
+func (m *AccountManager) SetGroup(email, group string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.accounts {
+		if m.accounts[i].Email == email {
+			m.accounts[i].Group = group
+			return m.saveLocked()
+		}
+	}
+	return fmt.Errorf("account not found")
+}
+
 // toCredentials converts an Account to Credentials.
 func (m *AccountManager) toCredentials(account *Account) *Credentials {
 	return &Credentials{
@@ -111,6 +203,79 @@ func (m *AccountManager) toCredentials(account *Account) *Credentials {
 	}
 }
 
+// Add inserts an account into the pool, replacing any existing account with
+// the same email, and persists the pool to the accounts.json file.
+func (m *AccountManager) Add(creds *Credentials) error {
+	if creds == nil {
+		return fmt.Errorf("credentials are nil")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	account := Account{
+		Email:        creds.Email,
+		AccessToken:  creds.AccessToken,
+		RefreshToken: creds.RefreshToken,
+		ExpiresIn:    creds.ExpiresIn,
+		Timestamp:    creds.Timestamp,
+		Expired:      creds.Expired,
+		ProjectID:    creds.ProjectID,
+	}
+
+	replaced := false
+	if account.Email != "" {
+		for i := range m.accounts {
+			if m.accounts[i].Email == account.Email {
+				// Keep the group assignment when re-adding an account
+				account.Group = m.accounts[i].Group
+				m.accounts[i] = account
+				replaced = true
+				break
+			}
+		}
+	}
+	if !replaced {
+		m.accounts = append(m.accounts, account)
+	}
+
+	if err := m.saveLocked(); err != nil {
+		return err
+	}
+
+	log.Infof("Added account %s to pool (%d accounts)", account.Email, len(m.accounts))
+	return nil
+}
+
+// List returns a copy of the loaded accounts.
+func (m *AccountManager) List() []Account {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Account(nil), m.accounts...)
+}
+
+// saveLocked writes all accounts and the current index to the accounts.json file.
+// Caller must hold the lock.
+func (m *AccountManager) saveLocked() error {
+	if err := os.MkdirAll(filepath.Dir(m.filePath), 0700); err != nil {
+		return fmt.Errorf("create accounts directory: %w", err)
+	}
+
+	data, err := json.MarshalIndent(AccountsFile{
+		Accounts:     m.accounts,
+		CurrentIndex: m.currentIndex,
+	}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal accounts file: %w", err)
+	}
+
+	if err := os.WriteFile(m.filePath, data, 0600); err != nil {
+		return fmt.Errorf("write accounts file: %w", err)
+	}
+
+	return nil
+}
+
 // SaveState persists the current state (index) back to the accounts.json file.
 func (m *AccountManager) SaveState() error {
 	m.mu.Lock()
@@ -180,10 +345,28 @@ func DefaultAccountsPath() string {
 	return filepath.Join(home, ".antigravity-wrapper", "accounts.json")
 }
 
-// LoadAccountManager attempts to load an AccountManager from the default path.
+// AccountsPath returns the accounts.json that belongs to the credentials
+// directory dir. An existing file at DefaultAccountsPath is still used when dir
+// has none, so that existing pools keep loading.
+func AccountsPath(dir string) string {
+	if dir == "" {
+		return DefaultAccountsPath()
+	}
+	path := filepath.Join(dir, "accounts.json")
+	if _, err := os.Stat(path); err == nil {
+		return path
+	}
+	if legacy := DefaultAccountsPath(); legacy != path {
+		if _, err := os.Stat(legacy); err == nil {
+			return legacy
+		}
+	}
+	return path
+}
+
+// LoadAccountManager attempts to load an AccountManager from path.
 // Returns nil if no accounts.json file exists.
-func LoadAccountManager(tokenManager *TokenManager) *AccountManager {
-	path := DefaultAccountsPath()
+func LoadAccountManager(path string, tokenManager *TokenManager) *AccountManager {
 
 	// Check if file exists
 	if _, err := os.Stat(path); os.IsNotExist(err) {
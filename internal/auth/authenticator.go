@@ -1,6 +1,7 @@
 package auth
 
 import (
+	"bufio"
 	"context"
 	"crypto/rand"
 	"encoding/base64"
@@ -10,6 +11,7 @@ import (
 	"net"
 	"net/http"
 	"net/url"
+	"os"
 	"strings"
 	"time"
 
@@ -26,6 +28,11 @@ const (
 	APIVersion     = "v1internal"
 )
 
+// LoopbackRedirectURI is the callback the OAuth client is registered for. The
+// login flows that cannot use a local callback server still use it, and have
+// the user paste the URL the browser was redirected to.
+var LoopbackRedirectURI = fmt.Sprintf("http://localhost:%d/oauth-callback", CallbackPort)
+
 var oauthScopes = []string{
 	"https://www.googleapis.com/auth/cloud-platform",
 	"https://www.googleapis.com/auth/userinfo.email",
@@ -53,7 +60,13 @@ func NewAuthenticator(store *Store, httpClient *http.Client) *Authenticator {
 
 // LoginOptions configures the login behavior.
 type LoginOptions struct {
+	// NoBrowser enables headless mode: no local callback server is started and
+	// the user pastes the redirected URL, or the code from it, back into the
+	// terminal.
 	NoBrowser bool
+
+	// Input is where headless mode reads the pasted URL from (default: os.Stdin).
+	Input io.Reader
 }
 
 // callbackResult holds the OAuth callback response.
@@ -74,44 +87,55 @@ func (a *Authenticator) Login(ctx context.Context, opts *LoginOptions) (*Credent
 		return nil, fmt.Errorf("generate state: %w", err)
 	}
 
-	srv, port, cbChan, err := a.startCallbackServer()
-	if err != nil {
-		return nil, fmt.Errorf("start callback server: %w", err)
-	}
-	defer func() {
-		shutdownCtx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
-		defer cancel()
-		_ = srv.Shutdown(shutdownCtx)
-	}()
-
-	redirectURI := fmt.Sprintf("http://localhost:%d/oauth-callback", port)
-	authURL := buildAuthURL(redirectURI, state)
-
-	fmt.Println("Opening browser for Antigravity authentication...")
-	fmt.Printf("\nVisit the following URL to authenticate:\n%s\n\n", authURL)
-	fmt.Println("Waiting for authentication callback...")
-
+	var redirectURI string
 	var cbRes callbackResult
-	select {
-	case res := <-cbChan:
-		cbRes = res
-	case <-time.After(5 * time.Minute):
-		return nil, fmt.Errorf("authentication timed out")
-	case <-ctx.Done():
-		return nil, ctx.Err()
+	if opts.NoBrowser {
+		redirectURI = LoopbackRedirectURI
+		cbRes, err = promptForCallback(ctx, opts.Input, buildAuthURL(redirectURI, state))
+	} else {
+		redirectURI, cbRes, err = a.waitForCallback(ctx, state)
+	}
+	if err != nil {
+		return nil, err
 	}
 
 	if cbRes.Error != "" {
 		return nil, fmt.Errorf("authentication failed: %s", cbRes.Error)
 	}
-	if cbRes.State != state {
+	// A bare code pasted in headless mode carries no state; a pasted URL's
+	// state must still match
+	if cbRes.State != state && !(opts.NoBrowser && cbRes.State == "") {
 		return nil, fmt.Errorf("invalid state parameter")
 	}
 	if cbRes.Code == "" {
 		return nil, fmt.Errorf("missing authorization code")
 	}
 
-	tokenResp, err := a.exchangeCode(ctx, cbRes.Code, redirectURI)
+	creds, err := a.ExchangeCredentials(ctx, cbRes.Code, redirectURI)
+	if err != nil {
+		return nil, err
+	}
+
+	if a.store != nil {
+		if path, err := a.store.Save(creds); err == nil {
+			fmt.Printf("Credentials saved to: %s\n", path)
+		} else {
+			log.Warnf("Failed to save credentials: %v", err)
+		}
+	}
+
+	fmt.Println("Authentication successful!")
+	if creds.ProjectID != "" {
+		fmt.Printf("Using GCP project: %s\n", creds.ProjectID)
+	}
+
+	return creds, nil
+}
+
+// ExchangeCredentials exchanges an authorization code for tokens and resolves
+// the account email and project ID. The credentials are not persisted.
+func (a *Authenticator) ExchangeCredentials(ctx context.Context, code, redirectURI string) (*Credentials, error) {
+	tokenResp, err := a.exchangeCode(ctx, code, redirectURI)
 	if err != nil {
 		return nil, fmt.Errorf("token exchange: %w", err)
 	}
@@ -134,7 +158,7 @@ func (a *Authenticator) Login(ctx context.Context, opts *LoginOptions) (*Credent
 	}
 
 	now := time.Now()
-	creds := &Credentials{
+	return &Credentials{
 		Type:         "antigravity",
 		AccessToken:  tokenResp.AccessToken,
 		RefreshToken: tokenResp.RefreshToken,
@@ -143,22 +167,118 @@ func (a *Authenticator) Login(ctx context.Context, opts *LoginOptions) (*Credent
 		Expired:      now.Add(time.Duration(tokenResp.ExpiresIn) * time.Second).Format(time.RFC3339),
 		Email:        email,
 		ProjectID:    projectID,
+	}, nil
+}
+
+// waitForCallback starts the local callback server and waits for the browser
+// to be redirected back to it.
+func (a *Authenticator) waitForCallback(ctx context.Context, state string) (string, callbackResult, error) {
+	srv, port, cbChan, err := a.startCallbackServer()
+	if err != nil {
+		return "", callbackResult{}, fmt.Errorf("start callback server: %w", err)
 	}
+	defer func() {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdownCtx)
+	}()
 
-	if a.store != nil {
-		if path, err := a.store.Save(creds); err == nil {
-			fmt.Printf("Credentials saved to: %s\n", path)
-		} else {
-			log.Warnf("Failed to save credentials: %v", err)
+	redirectURI := fmt.Sprintf("http://localhost:%d/oauth-callback", port)
+	authURL := buildAuthURL(redirectURI, state)
+
+	fmt.Println("Opening browser for Antigravity authentication...")
+	fmt.Printf("\nVisit the following URL to authenticate:\n%s\n\n", authURL)
+	fmt.Println("Waiting for authentication callback...")
+
+	select {
+	case res := <-cbChan:
+		return redirectURI, res, nil
+	case <-time.After(5 * time.Minute):
+		return "", callbackResult{}, fmt.Errorf("authentication timed out")
+	case <-ctx.Done():
+		return "", callbackResult{}, ctx.Err()
+	}
+}
+
+// promptForCallback asks the user to open the auth URL on any device and paste
+// the URL they were redirected to (or the code from it) back into the terminal.
+func promptForCallback(ctx context.Context, input io.Reader, authURL string) (callbackResult, error) {
+	if input == nil {
+		input = os.Stdin
+	}
+
+	fmt.Println("Headless login: open the following URL in a browser on any device:")
+	fmt.Printf("\n%s\n\n", authURL)
+	fmt.Println("After approving, the browser is redirected to a localhost page that will fail to load.")
+	fmt.Println("Copy the full URL from the address bar (or the code from it) and paste it here:")
+	fmt.Print("> ")
+
+	// Buffered, so that the reader can deliver its line and exit after the
+	// prompt timed out or was cancelled
+	type readResult struct {
+		line string
+		err  error
+	}
+	readCh := make(chan readResult, 1)
+	go func() {
+		line, err := bufio.NewReader(input).ReadString('\n')
+		if err != nil && strings.TrimSpace(line) == "" {
+			readCh <- readResult{err: err}
+			return
+		}
+		readCh <- readResult{line: line}
+	}()
+
+	select {
+	case read := <-readCh:
+		if read.err != nil {
+			return callbackResult{}, fmt.Errorf("read input: %w", read.err)
+		}
+		res := parseCallbackInput(read.line)
+		if res.Code == "" && res.Error == "" {
+			return callbackResult{}, fmt.Errorf("no authorization code found in input")
 		}
+		return res, nil
+	case <-time.After(5 * time.Minute):
+		return callbackResult{}, fmt.Errorf("authentication timed out")
+	case <-ctx.Done():
+		return callbackResult{}, ctx.Err()
 	}
+}
 
-	fmt.Println("Authentication successful!")
-	if projectID != "" {
-		fmt.Printf("Using GCP project: %s\n", projectID)
+// parseCallbackInput extracts the code, state and error from a pasted redirect
+// URL, a raw query string, or a bare authorization code.
+func parseCallbackInput(input string) callbackResult {
+	trimmed := strings.TrimSpace(input)
+	if trimmed == "" {
+		return callbackResult{}
 	}
 
-	return creds, nil
+	if !strings.Contains(trimmed, "code=") && !strings.Contains(trimmed, "error=") {
+		// Codes copied out of a URL are still percent-encoded (e.g. "4%2F0A...")
+		if code, err := url.QueryUnescape(trimmed); err == nil {
+			return callbackResult{Code: code}
+		}
+		return callbackResult{Code: trimmed}
+	}
+
+	query := trimmed
+	if idx := strings.Index(query, "?"); idx >= 0 {
+		query = query[idx+1:]
+	}
+	if idx := strings.Index(query, "#"); idx >= 0 {
+		query = query[:idx]
+	}
+
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		return callbackResult{}
+	}
+	return callbackResult{
+		Code:  strings.TrimSpace(values.Get("code")),
+		Error: strings.TrimSpace(values.Get("error")),
+		State: strings.TrimSpace(values.Get("state")),
+	}
 }
 
 func (a *Authenticator) startCallbackServer() (*http.Server, int, <-chan callbackResult, error) {
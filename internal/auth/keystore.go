@@ -8,6 +8,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/anthropics/antigravity-wrapper/internal/safety"
 	"github.com/google/uuid"
 )
 
@@ -17,11 +18,20 @@ const (
 
 // APIKey represents a generated API key.
 type APIKey struct {
-	Key           string    `json:"key"`
-	CreatedAt     time.Time `json:"created_at"`
-	Note          string    `json:"note,omitempty"`
-	RateLimit     int       `json:"rate_limit,omitempty"`     // RPM limit (0 = use global default)
-	AllowedModels []string  `json:"allowed_models,omitempty"` // Models this key can access (empty = all)
+	Key            string    `json:"key"`
+	CreatedAt      time.Time `json:"created_at"`
+	Note           string    `json:"note,omitempty"`
+	RateLimit      int       `json:"rate_limit,omitempty"`       // RPM limit (0 = use global default)
+	TokenRateLimit int       `json:"token_rate_limit,omitempty"` // TPM limit (0 = use global default)
+	AllowedModels  []string  `json:"allowed_models,omitempty"`   // Models this key can access (empty = all)
+	AccountGroup   string    `json:"account_group,omitempty"`    // Account group to bill (empty = shared pool)
+	SharedFallback bool      `json:"shared_fallback,omitempty"`  // Fall back to the shared pool if the group has no accounts
+	Priority       int       `json:"priority,omitempty"`         // Queue priority tier (higher is admitted first)
+	ResponseCache  *bool     `json:"response_cache,omitempty"`   // Response cache override (nil = use global default)
+	ThinkingBudget *int      `json:"thinking_budget,omitempty"`  // Default thinking budget (nil = use model default)
+	FilesQuota     int       `json:"files_quota,omitempty"`      // Files API storage in megabytes (0 = use global default)
+
+	Safety *safety.Policy `json:"safety,omitempty"` // Safety policy override (nil = use global policy)
 }
 
 // KeyStore manages API key persistence and validation.
@@ -51,19 +61,16 @@ func NewKeyStore(dir string) (*KeyStore, error) {
 	return ks, nil
 }
 
-// Generate creates a new API key and saves it to the store.
-func (ks *KeyStore) Generate(note string, rateLimit int, allowedModels []string) (*APIKey, error) {
+// Generate creates a new API key with the settings from template and saves it to the store.
+// The Key and CreatedAt fields of template are ignored.
+func (ks *KeyStore) Generate(template APIKey) (*APIKey, error) {
 	ks.mu.Lock()
 	defer ks.mu.Unlock()
 
 	key := uuid.New().String()
-	apiKey := &APIKey{
-		Key:           key,
-		CreatedAt:     time.Now(),
-		Note:          note,
-		RateLimit:     rateLimit,
-		AllowedModels: allowedModels,
-	}
+	apiKey := &template
+	apiKey.Key = key
+	apiKey.CreatedAt = time.Now()
 
 	ks.keys[key] = apiKey
 
@@ -75,25 +82,31 @@ func (ks *KeyStore) Generate(note string, rateLimit int, allowedModels []string)
 	return apiKey, nil
 }
 
-// Update modifies an existing API key.
-func (ks *KeyStore) Update(key string, note string, rateLimit int, allowedModels []string) (*APIKey, error) {
+// Update changes the settings of an existing API key. apply is called on a
+// copy of the key, which replaces the stored key once it has been saved, so
+// callers holding the previous key from Get never see a partial update. The
+// Key and CreatedAt fields cannot be changed.
+func (ks *KeyStore) Update(key string, apply func(*APIKey)) (*APIKey, error) {
 	ks.mu.Lock()
 	defer ks.mu.Unlock()
 
-	apiKey, exists := ks.keys[key]
+	original, exists := ks.keys[key]
 	if !exists {
 		return nil, fmt.Errorf("key not found")
 	}
 
-	apiKey.Note = note
-	apiKey.RateLimit = rateLimit
-	apiKey.AllowedModels = allowedModels
+	apiKey := *original
+	apply(&apiKey)
+	apiKey.Key = original.Key
+	apiKey.CreatedAt = original.CreatedAt
+	ks.keys[key] = &apiKey
 
 	if err := ks.save(); err != nil {
+		ks.keys[key] = original // Rollback
 		return nil, fmt.Errorf("save keys: %w", err)
 	}
 
-	return apiKey, nil
+	return &apiKey, nil
 }
 
 // Validate checks if the provided API key is valid.
@@ -0,0 +1,102 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// oauthFlowTTL bounds how long a started login may wait for its callback.
+const oauthFlowTTL = 10 * time.Minute
+
+// pendingLogin tracks a login that was started but not yet completed.
+type pendingLogin struct {
+	redirectURI string
+	expiresAt   time.Time
+}
+
+// OAuthFlow manages browser-based logins that are started through the admin
+// API and completed by a callback on the main server.
+type OAuthFlow struct {
+	authenticator *Authenticator
+	mu            sync.Mutex
+	pending       map[string]pendingLogin
+}
+
+// NewOAuthFlow creates a new OAuthFlow backed by the given authenticator.
+func NewOAuthFlow(authenticator *Authenticator) *OAuthFlow {
+	return &OAuthFlow{
+		authenticator: authenticator,
+		pending:       make(map[string]pendingLogin),
+	}
+}
+
+// Start registers a new login and returns the URL the user must visit along
+// with the state parameter that identifies it.
+func (f *OAuthFlow) Start(redirectURI string) (string, string, error) {
+	if redirectURI == "" {
+		return "", "", fmt.Errorf("redirect URI cannot be empty")
+	}
+
+	state, err := generateRandomState()
+	if err != nil {
+		return "", "", fmt.Errorf("generate state: %w", err)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.pruneLocked()
+	f.pending[state] = pendingLogin{
+		redirectURI: redirectURI,
+		expiresAt:   time.Now().Add(oauthFlowTTL),
+	}
+
+	return buildAuthURL(redirectURI, state), state, nil
+}
+
+// Complete finishes the login identified by state using the authorization code
+// returned by Google. Each state can only be completed once.
+func (f *OAuthFlow) Complete(ctx context.Context, state, code string) (*Credentials, error) {
+	f.mu.Lock()
+	login, ok := f.pending[state]
+	delete(f.pending, state)
+	f.mu.Unlock()
+
+	if !ok {
+		return nil, fmt.Errorf("unknown or already used state parameter")
+	}
+	if time.Now().After(login.expiresAt) {
+		return nil, fmt.Errorf("login session expired")
+	}
+	if code == "" {
+		return nil, fmt.Errorf("missing authorization code")
+	}
+
+	return f.authenticator.ExchangeCredentials(ctx, code, login.redirectURI)
+}
+
+// CompleteFromURL finishes a login from the URL the browser was redirected
+// to, for logins whose redirect URI the admin's browser cannot reach (such as
+// LoopbackRedirectURI). The URL must carry the state parameter.
+func (f *OAuthFlow) CompleteFromURL(ctx context.Context, callbackURL string) (*Credentials, error) {
+	res := parseCallbackInput(callbackURL)
+	if res.Error != "" {
+		return nil, fmt.Errorf("authentication failed: %s", res.Error)
+	}
+	if res.State == "" {
+		return nil, fmt.Errorf("no state parameter in callback URL; paste the full redirected URL")
+	}
+	return f.Complete(ctx, res.State, res.Code)
+}
+
+// pruneLocked drops expired logins. Caller must hold the lock.
+func (f *OAuthFlow) pruneLocked() {
+	now := time.Now()
+	for state, login := range f.pending {
+		if now.After(login.expiresAt) {
+			delete(f.pending, state)
+		}
+	}
+}
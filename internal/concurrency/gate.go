@@ -0,0 +1,146 @@
+// Package concurrency bounds in-flight upstream calls per account and globally,
+// queueing excess requests by priority.
+package concurrency
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// Errors returned when a request cannot be admitted.
+var (
+	ErrQueueFull    = errors.New("request queue is full")
+	ErrQueueTimeout = errors.New("timed out waiting in request queue")
+)
+
+// waiter is a request waiting for a slot.
+type waiter struct {
+	priority int
+	seq      uint64
+	ready    chan struct{}
+	index    int // position in the heap, -1 once granted
+}
+
+// waiterHeap orders waiters by priority (highest first), then arrival.
+type waiterHeap []*waiter
+
+func (h waiterHeap) Len() int { return len(h) }
+
+func (h waiterHeap) Less(i, j int) bool {
+	if h[i].priority != h[j].priority {
+		return h[i].priority > h[j].priority
+	}
+	return h[i].seq < h[j].seq
+}
+
+func (h waiterHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *waiterHeap) Push(x any) {
+	w := x.(*waiter)
+	w.index = len(*h)
+	*h = append(*h, w)
+}
+
+func (h *waiterHeap) Pop() any {
+	old := *h
+	n := len(old)
+	w := old[n-1]
+	old[n-1] = nil
+	w.index = -1
+	*h = old[:n-1]
+	return w
+}
+
+// Gate is a counting semaphore with a bounded priority wait queue.
+type Gate struct {
+	mu       sync.Mutex
+	limit    int
+	maxQueue int
+	inFlight int
+	seq      uint64
+	waiters  waiterHeap
+}
+
+// NewGate creates a gate admitting up to limit concurrent holders, with at
+// most maxQueue waiters (0 = unbounded).
+func NewGate(limit, maxQueue int) *Gate {
+	return &Gate{
+		limit:    limit,
+		maxQueue: maxQueue,
+	}
+}
+
+// Acquire waits for a slot. Higher priority waiters are admitted first.
+// The caller must call Release once done.
+func (g *Gate) Acquire(ctx context.Context, priority int, timeout time.Duration) error {
+	g.mu.Lock()
+	if g.inFlight < g.limit && len(g.waiters) == 0 {
+		g.inFlight++
+		g.mu.Unlock()
+		return nil
+	}
+	if g.maxQueue > 0 && len(g.waiters) >= g.maxQueue {
+		g.mu.Unlock()
+		return ErrQueueFull
+	}
+
+	g.seq++
+	w := &waiter{priority: priority, seq: g.seq, ready: make(chan struct{})}
+	heap.Push(&g.waiters, w)
+	g.mu.Unlock()
+
+	var timeoutCh <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		timeoutCh = timer.C
+	}
+
+	var err error
+	select {
+	case <-w.ready:
+		return nil
+	case <-timeoutCh:
+		err = ErrQueueTimeout
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if w.index < 0 {
+		// The slot was handed over while we were giving up; keep it
+		return nil
+	}
+	heap.Remove(&g.waiters, w.index)
+	return err
+}
+
+// Release frees a slot, handing it to the highest priority waiter if any.
+func (g *Gate) Release() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if len(g.waiters) > 0 {
+		w := heap.Pop(&g.waiters).(*waiter)
+		close(w.ready)
+		return
+	}
+	if g.inFlight > 0 {
+		g.inFlight--
+	}
+}
+
+// Stats returns the number of in-flight holders and queued waiters.
+func (g *Gate) Stats() (inFlight, queued int) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.inFlight, len(g.waiters)
+}
@@ -0,0 +1,167 @@
+package concurrency
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/anthropics/antigravity-wrapper/internal/metrics"
+)
+
+// Limiter bounds in-flight upstream calls globally and per account.
+type Limiter struct {
+	global     *Gate // nil when unlimited
+	perAccount int   // 0 = unlimited
+	maxQueue   int
+	timeout    time.Duration
+
+	mu       sync.Mutex
+	accounts map[string]*Gate
+}
+
+// NewLimiter creates a limiter. A limit of 0 disables the corresponding bound.
+func NewLimiter(globalLimit, perAccountLimit, maxQueue int, timeout time.Duration) *Limiter {
+	l := &Limiter{
+		perAccount: perAccountLimit,
+		maxQueue:   maxQueue,
+		timeout:    timeout,
+		accounts:   make(map[string]*Gate),
+	}
+	if globalLimit > 0 {
+		l.global = NewGate(globalLimit, maxQueue)
+	}
+	return l
+}
+
+// Enabled reports whether any bound is configured.
+func (l *Limiter) Enabled() bool {
+	return l != nil && (l.global != nil || l.perAccount > 0)
+}
+
+// Ticket is an admitted request. Release must be called once it completes.
+type Ticket struct {
+	// Wait is how long the request spent queued.
+	Wait time.Duration
+	// QueueDepth is the number of requests that were queued ahead on admission.
+	QueueDepth int
+
+	limiter *Limiter
+	account string
+	gates   []*Gate
+	once    sync.Once
+}
+
+// Acquire admits a request for the given account, waiting in the account queue
+// and then the global queue. Higher priority requests are admitted first.
+func (l *Limiter) Acquire(ctx context.Context, account string, priority int) (*Ticket, error) {
+	ticket := &Ticket{limiter: l, account: account}
+	if !l.Enabled() {
+		return ticket, nil
+	}
+
+	gates := make([]*Gate, 0, 2)
+	if g := l.accountGate(account); g != nil {
+		gates = append(gates, g)
+	}
+	if l.global != nil {
+		gates = append(gates, l.global)
+	}
+
+	for _, g := range gates {
+		_, queued := g.Stats()
+		ticket.QueueDepth += queued
+	}
+
+	start := time.Now()
+	for _, g := range gates {
+		remaining := l.timeout
+		if l.timeout > 0 {
+			remaining = l.timeout - time.Since(start)
+			if remaining <= 0 {
+				ticket.Release()
+				l.reject(ErrQueueTimeout)
+				return nil, ErrQueueTimeout
+			}
+		}
+
+		l.report(account)
+		if err := g.Acquire(ctx, priority, remaining); err != nil {
+			ticket.Release()
+			l.reject(err)
+			return nil, err
+		}
+		ticket.gates = append(ticket.gates, g)
+	}
+	ticket.Wait = time.Since(start)
+
+	metrics.Default().Observe("antigravity_queue_wait_seconds", "Time requests spent waiting for a concurrency slot.", nil, ticket.Wait.Seconds())
+	l.report(account)
+	return ticket, nil
+}
+
+// Release frees the slots held by the ticket. It is safe to call more than once.
+func (t *Ticket) Release() {
+	if t == nil {
+		return
+	}
+	t.once.Do(func() {
+		for i := len(t.gates) - 1; i >= 0; i-- {
+			t.gates[i].Release()
+		}
+		if t.limiter.Enabled() {
+			t.limiter.report(t.account)
+		}
+	})
+}
+
+// accountGate returns the gate for account, creating it on first use.
+func (l *Limiter) accountGate(account string) *Gate {
+	if l.perAccount <= 0 {
+		return nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	g, ok := l.accounts[account]
+	if !ok {
+		g = NewGate(l.perAccount, l.maxQueue)
+		l.accounts[account] = g
+	}
+	return g
+}
+
+// report publishes in-flight and queue depth gauges for the global and account gates.
+func (l *Limiter) report(account string) {
+	if l.global != nil {
+		inFlight, queued := l.global.Stats()
+		setGauges(metrics.Labels{"scope": "global"}, inFlight, queued)
+	}
+	if l.perAccount > 0 {
+		l.mu.Lock()
+		g := l.accounts[account]
+		l.mu.Unlock()
+		if g != nil {
+			inFlight, queued := g.Stats()
+			setGauges(metrics.Labels{"scope": "account", "account": account}, inFlight, queued)
+		}
+	}
+}
+
+// reject counts a request that was not admitted.
+func (l *Limiter) reject(err error) {
+	reason := "canceled"
+	switch {
+	case errors.Is(err, ErrQueueFull):
+		reason = "queue_full"
+	case errors.Is(err, ErrQueueTimeout):
+		reason = "queue_timeout"
+	}
+	metrics.Default().AddCounter("antigravity_queue_rejected_total", "Requests rejected by the concurrency limiter.", metrics.Labels{"reason": reason}, 1)
+}
+
+func setGauges(labels metrics.Labels, inFlight, queued int) {
+	metrics.Default().SetGauge("antigravity_inflight_requests", "Upstream calls currently in flight.", labels, float64(inFlight))
+	metrics.Default().SetGauge("antigravity_queue_depth", "Requests waiting for a concurrency slot.", labels, float64(queued))
+}
@@ -6,6 +6,7 @@ import (
 	"path/filepath"
 	"strings"
 
+	"github.com/anthropics/antigravity-wrapper/internal/safety"
 	log "github.com/sirupsen/logrus"
 	"gopkg.in/yaml.v3"
 )
@@ -18,9 +19,52 @@ type Config struct {
 	APIKeys   []string `yaml:"api_keys"`
 	RateLimit int      `yaml:"rate_limit"`
 
+	// Rate limit settings
+	TokenRateLimit   int    `yaml:"token_rate_limit"`   // Tokens per minute per key (0 = unlimited)
+	RateLimitBackend string `yaml:"rate_limit_backend"` // "memory" (default) or "redis"
+	RateLimitRedis   string `yaml:"rate_limit_redis"`   // redis://[:password@]host:port[/db]
+
+	// Concurrency settings (0 = unlimited)
+	MaxConcurrency           int `yaml:"max_concurrency"`             // Global in-flight upstream calls
+	MaxConcurrencyPerAccount int `yaml:"max_concurrency_per_account"` // In-flight upstream calls per account
+	MaxQueueSize             int `yaml:"max_queue_size"`              // Requests allowed to wait for a slot
+	QueueTimeout             int `yaml:"queue_timeout"`               // Seconds a request may wait for a slot
+
+	// HeartbeatInterval is the number of seconds a stream may stay silent
+	// before a keepalive is sent downstream (0 = disabled)
+	HeartbeatInterval int `yaml:"heartbeat_interval"`
+
+	// ContextStrategy selects how requests that exceed the model's context
+	// window are handled: "reject" (default), "truncate" or "summarize"
+	ContextStrategy string `yaml:"context_strategy"`
+
+	// ContextWindows overrides the built-in context window per model ID, in
+	// tokens (0 = no check).
+	ContextWindows map[string]int `yaml:"context_windows"`
+
+	// Response cache settings for deterministic (temperature 0) requests
+	ResponseCache           bool   `yaml:"response_cache"`             // Cache responses by default (API keys may override)
+	ResponseCacheBackend    string `yaml:"response_cache_backend"`     // "memory" (default) or "disk" (stored in data_dir)
+	ResponseCacheTTL        int    `yaml:"response_cache_ttl"`         // Seconds a response stays cached
+	ResponseCacheMaxEntries int    `yaml:"response_cache_max_entries"` // Maximum cached responses
+
+	// Remote media settings for image and document URLs in requests
+	MediaMaxSize      int  `yaml:"media_max_size"`      // Largest download, in megabytes
+	MediaTimeout      int  `yaml:"media_timeout"`       // Seconds a download may take
+	MediaAllowPrivate bool `yaml:"media_allow_private"` // Allow URLs resolving to private or loopback addresses
+
+	// Audio input limits for input_audio parts (0 = unlimited)
+	AudioMaxSize     int `yaml:"audio_max_size"`     // Largest clip, in megabytes
+	AudioMaxDuration int `yaml:"audio_max_duration"` // Longest WAV or MP3 clip, in seconds
+
+	// Files API settings; files are stored in data_dir/files
+	FilesMaxSize int `yaml:"files_max_size"` // Largest upload, in megabytes (0 = unlimited)
+	FilesQuota   int `yaml:"files_quota"`    // Storage per API key, in megabytes (0 = unlimited)
+
 	// Security settings
-	MasterSecret string `yaml:"master_secret"`
-	DataDir      string `yaml:"data_dir"`
+	MasterSecret    string `yaml:"master_secret"`
+	SignatureSecret string `yaml:"signature_secret"` // Key for thought signature envelopes
+	DataDir         string `yaml:"data_dir"`
 
 	// Proxy settings
 	ProxyURL string `yaml:"proxy_url"`
@@ -28,9 +72,24 @@ type Config struct {
 	// Feature flags
 	ThinkingAsContent bool `yaml:"thinking_as_content"`
 
+	// Safety is the safety policy applied to requests. API keys can override it.
+	Safety safety.Policy `yaml:"safety"`
+
+	// ModelSafety replaces the safety policy per model ID. API keys with their
+	// own policy still override it.
+	ModelSafety map[string]safety.Policy `yaml:"model_safety"`
+
+	// ThinkingBudgets overrides the built-in default thinking budget per model
+	// ID. Clients and API keys can still choose their own budget.
+	ThinkingBudgets map[string]int `yaml:"thinking_budgets"`
+
 	// Credentials settings
 	CredentialsDir string `yaml:"credentials_dir"`
 
+	// OAuthRedirectURL is the public URL of the /oauth-callback route used by
+	// admin-driven logins (the loopback callback when empty)
+	OAuthRedirectURL string `yaml:"oauth_redirect_url"`
+
 	// Logging settings
 	LogLevel string `yaml:"log_level"`
 	Debug    bool   `yaml:"debug"`
@@ -39,13 +98,24 @@ type Config struct {
 // DefaultConfig returns a configuration with sensible defaults.
 func DefaultConfig() *Config {
 	return &Config{
-		Port:           8080,
-		Host:           "0.0.0.0",
-		DataDir:        "data",
-		CredentialsDir: defaultCredentialsDir(),
-		LogLevel:       "info",
-		Debug:          false,
-		RateLimit:      1000,
+		Port:                    8080,
+		Host:                    "0.0.0.0",
+		DataDir:                 "data",
+		CredentialsDir:          defaultCredentialsDir(),
+		LogLevel:                "info",
+		Debug:                   false,
+		RateLimit:               1000,
+		MaxQueueSize:            100,
+		QueueTimeout:            60,
+		HeartbeatInterval:       15,
+		ResponseCacheTTL:        3600,
+		ResponseCacheMaxEntries: 1000,
+		MediaMaxSize:            20,
+		MediaTimeout:            15,
+		AudioMaxSize:            20,
+		AudioMaxDuration:        600,
+		FilesMaxSize:            100,
+		FilesQuota:              1024,
 	}
 }
 
@@ -93,6 +163,10 @@ func (c *Config) applyEnvOverrides() {
 		c.MasterSecret = v
 	}
 
+	if v := os.Getenv("ANTIGRAVITY_SIGNATURE_SECRET"); v != "" {
+		c.SignatureSecret = v
+	}
+
 	if v := os.Getenv("ANTIGRAVITY_DATA_DIR"); v != "" {
 		c.DataDir = v
 	}
@@ -109,6 +183,10 @@ func (c *Config) applyEnvOverrides() {
 		c.CredentialsDir = v
 	}
 
+	if v := os.Getenv("ANTIGRAVITY_OAUTH_REDIRECT_URL"); v != "" {
+		c.OAuthRedirectURL = v
+	}
+
 	if v := os.Getenv("ANTIGRAVITY_API_KEYS"); v != "" {
 		keys := strings.Split(v, ",")
 		for i, k := range keys {
@@ -130,6 +208,102 @@ func (c *Config) applyEnvOverrides() {
 			c.RateLimit = limit
 		}
 	}
+
+	if v := os.Getenv("ANTIGRAVITY_TOKEN_RATE_LIMIT"); v != "" {
+		if limit, err := parsePort(v); err == nil {
+			c.TokenRateLimit = limit
+		}
+	}
+
+	if v := os.Getenv("ANTIGRAVITY_RATE_LIMIT_BACKEND"); v != "" {
+		c.RateLimitBackend = v
+	}
+
+	if v := os.Getenv("ANTIGRAVITY_RATE_LIMIT_REDIS"); v != "" {
+		c.RateLimitRedis = v
+	}
+
+	if v := os.Getenv("ANTIGRAVITY_HEARTBEAT_INTERVAL"); v != "" {
+		if interval, err := parsePort(v); err == nil {
+			c.HeartbeatInterval = interval
+		}
+	}
+
+	if v := os.Getenv("ANTIGRAVITY_CONTEXT_STRATEGY"); v != "" {
+		c.ContextStrategy = v
+	}
+
+	if v := os.Getenv("ANTIGRAVITY_RESPONSE_CACHE"); v == "true" || v == "1" {
+		c.ResponseCache = true
+	}
+
+	if v := os.Getenv("ANTIGRAVITY_RESPONSE_CACHE_BACKEND"); v != "" {
+		c.ResponseCacheBackend = v
+	}
+
+	if v := os.Getenv("ANTIGRAVITY_MEDIA_MAX_SIZE"); v != "" {
+		if size, err := parsePort(v); err == nil {
+			c.MediaMaxSize = size
+		}
+	}
+
+	if v := os.Getenv("ANTIGRAVITY_MEDIA_TIMEOUT"); v != "" {
+		if timeout, err := parsePort(v); err == nil {
+			c.MediaTimeout = timeout
+		}
+	}
+
+	if v := os.Getenv("ANTIGRAVITY_MEDIA_ALLOW_PRIVATE"); v == "true" || v == "1" {
+		c.MediaAllowPrivate = true
+	}
+
+	if v := os.Getenv("ANTIGRAVITY_AUDIO_MAX_SIZE"); v != "" {
+		if size, err := parsePort(v); err == nil {
+			c.AudioMaxSize = size
+		}
+	}
+
+	if v := os.Getenv("ANTIGRAVITY_AUDIO_MAX_DURATION"); v != "" {
+		if duration, err := parsePort(v); err == nil {
+			c.AudioMaxDuration = duration
+		}
+	}
+
+	if v := os.Getenv("ANTIGRAVITY_FILES_MAX_SIZE"); v != "" {
+		if size, err := parsePort(v); err == nil {
+			c.FilesMaxSize = size
+		}
+	}
+
+	if v := os.Getenv("ANTIGRAVITY_FILES_QUOTA"); v != "" {
+		if quota, err := parsePort(v); err == nil {
+			c.FilesQuota = quota
+		}
+	}
+
+	if v := os.Getenv("ANTIGRAVITY_MAX_CONCURRENCY"); v != "" {
+		if limit, err := parsePort(v); err == nil {
+			c.MaxConcurrency = limit
+		}
+	}
+
+	if v := os.Getenv("ANTIGRAVITY_MAX_CONCURRENCY_PER_ACCOUNT"); v != "" {
+		if limit, err := parsePort(v); err == nil {
+			c.MaxConcurrencyPerAccount = limit
+		}
+	}
+
+	if v := os.Getenv("ANTIGRAVITY_MAX_QUEUE_SIZE"); v != "" {
+		if size, err := parsePort(v); err == nil {
+			c.MaxQueueSize = size
+		}
+	}
+
+	if v := os.Getenv("ANTIGRAVITY_QUEUE_TIMEOUT"); v != "" {
+		if timeout, err := parsePort(v); err == nil {
+			c.QueueTimeout = timeout
+		}
+	}
 }
 
 // parsePort is a simple port parser.
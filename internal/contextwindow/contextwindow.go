@@ -0,0 +1,206 @@
+// Package contextwindow checks that requests fit a model's context window and,
+// depending on the configured strategy, trims the oldest conversation turns.
+package contextwindow
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/anthropics/antigravity-wrapper/internal/tokenizer"
+	log "github.com/sirupsen/logrus"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// Strategy selects what happens to a request that does not fit.
+type Strategy string
+
+const (
+	// StrategyReject fails the request with an ExceededError.
+	StrategyReject Strategy = "reject"
+	// StrategyTruncate drops the oldest turns until the request fits.
+	StrategyTruncate Strategy = "truncate"
+	// StrategySummarize drops the oldest turns and replaces them with a summary.
+	StrategySummarize Strategy = "summarize"
+)
+
+// summaryReserve is the budget kept free for the summary of dropped turns.
+const summaryReserve = 1024
+
+// ParseStrategy validates a strategy name. An empty name selects StrategyReject.
+func ParseStrategy(name string) (Strategy, error) {
+	switch Strategy(name) {
+	case "":
+		return StrategyReject, nil
+	case StrategyReject, StrategyTruncate, StrategySummarize:
+		return Strategy(name), nil
+	default:
+		return "", fmt.Errorf("unknown context strategy: %s", name)
+	}
+}
+
+// ExceededError reports a request that does not fit the context window.
+type ExceededError struct {
+	Tokens int // Estimated input tokens
+	Limit  int // Input tokens available after reserving output tokens
+}
+
+func (e *ExceededError) Error() string {
+	return fmt.Sprintf("prompt is too long: %d tokens > %d maximum", e.Tokens, e.Limit)
+}
+
+// Summarizer returns a summary of a JSON array of Gemini contents.
+type Summarizer func(ctx context.Context, contents []byte) (string, error)
+
+// Options control how Fit handles oversized requests.
+type Options struct {
+	Strategy Strategy
+
+	// Count, if set, returns an accurate input token count for a payload. It is
+	// only consulted when the local estimate exceeds the limit.
+	Count func(ctx context.Context, payload []byte) int
+
+	// Summarize is required by StrategySummarize. If it fails, Fit falls back
+	// to plain truncation.
+	Summarize Summarizer
+}
+
+// Fit returns payload unchanged if its input and requested output fit within
+// limit tokens. Otherwise it applies the configured strategy, returning either
+// a trimmed payload or an *ExceededError. A limit of 0 disables the check.
+func Fit(ctx context.Context, payload []byte, limit int, opts Options) ([]byte, error) {
+	if limit <= 0 {
+		return payload, nil
+	}
+
+	budget := limit
+	if maxOutput := int(gjson.GetBytes(payload, "request.generationConfig.maxOutputTokens").Int()); maxOutput > 0 && maxOutput < limit {
+		budget -= maxOutput
+	}
+
+	estimate := tokenizer.EstimateRequest(payload)
+	if estimate <= budget {
+		return payload, nil
+	}
+
+	// Confirm with an accurate count before acting on an estimate, and use it
+	// to correct the estimates made while trimming
+	tokens := estimate
+	if opts.Count != nil {
+		if counted := opts.Count(ctx, payload); counted > 0 {
+			tokens = counted
+		}
+		if tokens <= budget {
+			return payload, nil
+		}
+	}
+	scale := float64(tokens) / float64(estimate)
+
+	if opts.Strategy != StrategyTruncate && opts.Strategy != StrategySummarize {
+		return nil, &ExceededError{Tokens: tokens, Limit: budget}
+	}
+
+	contents := gjson.GetBytes(payload, "request.contents").Array()
+	starts := turnStarts(contents)
+
+	// Everything but the contents is always kept
+	withoutContents, _ := sjson.SetRawBytes(payload, "request.contents", []byte("[]"))
+	fixed := tokenizer.EstimateRequest(withoutContents)
+
+	available := budget
+	if opts.Strategy == StrategySummarize && opts.Summarize != nil {
+		available -= min(summaryReserve, budget/4)
+	}
+
+	// Find the earliest turn from which the rest of the conversation fits
+	keepFrom := -1
+	suffix := 0
+	for i := len(starts) - 1; i >= 0; i-- {
+		end := len(contents)
+		if i+1 < len(starts) {
+			end = starts[i+1]
+		}
+		for _, content := range contents[starts[i]:end] {
+			suffix += tokenizer.EstimateContent(content)
+		}
+		if int(float64(fixed+suffix)*scale) > available {
+			break
+		}
+		keepFrom = starts[i]
+	}
+	if keepFrom <= 0 {
+		// Either nothing can be dropped or even the last turn does not fit
+		return nil, &ExceededError{Tokens: tokens, Limit: budget}
+	}
+
+	kept := contents[keepFrom:]
+	log.Infof("Dropping %d of %d messages to fit the context window (%d tokens > %d)", keepFrom, len(contents), tokens, budget)
+
+	summary := ""
+	if opts.Strategy == StrategySummarize && opts.Summarize != nil {
+		var err error
+		summary, err = opts.Summarize(ctx, []byte(joinContents(contents[:keepFrom])))
+		if err != nil {
+			log.Warnf("Failed to summarize dropped messages, truncating instead: %v", err)
+			summary = ""
+		}
+	}
+
+	out := joinContents(kept)
+	if summary != "" {
+		// Prepend the summary to the first kept user message to preserve role alternation
+		part := `{}`
+		part, _ = sjson.Set(part, "text", "<conversation_summary>\n"+summary+"\n</conversation_summary>")
+		parts := `[]`
+		parts, _ = sjson.SetRaw(parts, "-1", part)
+		kept[0].Get("parts").ForEach(func(_, p gjson.Result) bool {
+			parts, _ = sjson.SetRaw(parts, "-1", p.Raw)
+			return true
+		})
+		out, _ = sjson.SetRaw(out, "0.parts", parts)
+	}
+
+	trimmed, err := sjson.SetRawBytes(payload, "request.contents", []byte(out))
+	if err != nil {
+		return nil, fmt.Errorf("trim contents: %w", err)
+	}
+	return trimmed, nil
+}
+
+// turnStarts returns the indexes of contents that begin a turn: a user message
+// that is not a tool response. Dropping whole turns keeps each function call
+// together with its response and leaves the conversation starting with a user
+// message.
+func turnStarts(contents []gjson.Result) []int {
+	starts := make([]int, 0, len(contents))
+	for i, content := range contents {
+		if content.Get("role").String() != "user" {
+			continue
+		}
+		isToolResponse := false
+		content.Get("parts").ForEach(func(_, part gjson.Result) bool {
+			if part.Get("functionResponse").Exists() {
+				isToolResponse = true
+				return false
+			}
+			return true
+		})
+		if !isToolResponse {
+			starts = append(starts, i)
+		}
+	}
+	if len(starts) == 0 || starts[0] != 0 {
+		// Leading contents that are not a user message belong to the first turn
+		starts = append([]int{0}, starts...)
+	}
+	return starts
+}
+
+// joinContents renders contents as a JSON array.
+func joinContents(contents []gjson.Result) string {
+	out := `[]`
+	for _, content := range contents {
+		out, _ = sjson.SetRaw(out, "-1", content.Raw)
+	}
+	return out
+}
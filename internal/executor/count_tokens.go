@@ -0,0 +1,118 @@
+package executor
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/anthropics/antigravity-wrapper/internal/auth"
+	"github.com/anthropics/antigravity-wrapper/internal/models"
+	log "github.com/sirupsen/logrus"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// CountTokensPath is the upstream token counting method.
+const CountTokensPath = "/v1internal:countTokens"
+
+// countTokensRetry is how long countTokens is not tried again for a model
+// after the upstream has reported that it does not support it.
+const countTokensRetry = time.Hour
+
+// ErrCountTokensUnsupported is returned once the upstream has reported that it
+// does not implement countTokens for a model; callers should fall back to
+// estimation.
+var ErrCountTokensUnsupported = errors.New("upstream countTokens is not supported")
+
+// CountTokens asks the upstream to count the input tokens of an Antigravity
+// request. Only the system instruction and contents are counted; the upstream
+// method does not accept tool declarations.
+func (e *Executor) CountTokens(ctx context.Context, creds *auth.Credentials, req Request) (int64, error) {
+	if retryAt, ok := e.countTokensUnsupported.Load(req.Model); ok {
+		if time.Now().Before(retryAt.(time.Time)) {
+			return 0, ErrCountTokensUnsupported
+		}
+		e.countTokensUnsupported.Delete(req.Model)
+	}
+
+	token, err := e.ensureAccessToken(ctx, creds)
+	if err != nil {
+		return 0, err
+	}
+
+	payload := buildCountTokensPayload(req.Model, req.Payload)
+
+	for _, baseURL := range e.baseURLFallbackOrder(creds) {
+		httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, baseURL+CountTokensPath, bytes.NewReader(payload))
+		if err != nil {
+			return 0, err
+		}
+		httpReq.Header.Set("Content-Type", "application/json")
+		httpReq.Header.Set("Accept", "application/json")
+		httpReq.Header.Set("Authorization", "Bearer "+token)
+		httpReq.Header.Set("User-Agent", e.resolveUserAgent(creds))
+		if host := resolveHost(baseURL); host != "" {
+			httpReq.Host = host
+		}
+
+		httpResp, err := e.httpClient.Do(httpReq)
+		if err != nil {
+			log.Debugf("Count tokens error on %s: %v", baseURL, err)
+			continue
+		}
+		bodyBytes, err := io.ReadAll(httpResp.Body)
+		httpResp.Body.Close()
+		if err != nil {
+			return 0, err
+		}
+
+		switch {
+		case httpResp.StatusCode == http.StatusNotFound || httpResp.StatusCode == http.StatusNotImplemented:
+			log.Infof("Upstream does not support countTokens for %s (status %d), using local estimates for %s",
+				req.Model, httpResp.StatusCode, countTokensRetry)
+			e.countTokensUnsupported.Store(req.Model, time.Now().Add(countTokensRetry))
+			return 0, ErrCountTokensUnsupported
+		case httpResp.StatusCode < 200 || httpResp.StatusCode >= 300:
+			log.Debugf("Count tokens failed on %s: status %d", baseURL, httpResp.StatusCode)
+			continue
+		}
+
+		total := gjson.GetBytes(bodyBytes, "totalTokens")
+		if !total.Exists() {
+			return 0, fmt.Errorf("count tokens: missing totalTokens in response")
+		}
+		return total.Int(), nil
+	}
+
+	return 0, fmt.Errorf("count tokens: all base URLs exhausted")
+}
+
+// buildCountTokensPayload reshapes an Antigravity generate request into a
+// countTokens request. The system instruction is counted as a leading user turn.
+func buildCountTokensPayload(modelName string, payload []byte) []byte {
+	internalModelName := models.Alias2ModelName(modelName)
+	if !strings.HasPrefix(internalModelName, "models/") {
+		internalModelName = "models/" + internalModelName
+	}
+
+	out := `{"request":{"model":"","contents":[]}}`
+	out, _ = sjson.Set(out, "request.model", internalModelName)
+
+	request := gjson.GetBytes(payload, "request")
+	if system := request.Get("systemInstruction.parts"); system.IsArray() && len(system.Array()) > 0 {
+		content := `{"role":"user","parts":[]}`
+		content, _ = sjson.SetRaw(content, "parts", system.Raw)
+		out, _ = sjson.SetRaw(out, "request.contents.-1", content)
+	}
+	request.Get("contents").ForEach(func(_, content gjson.Result) bool {
+		out, _ = sjson.SetRaw(out, "request.contents.-1", content.Raw)
+		return true
+	})
+
+	return []byte(out)
+}
@@ -4,12 +4,16 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"math/rand"
 	"net/http"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/anthropics/antigravity-wrapper/internal/auth"
@@ -38,6 +42,10 @@ type Executor struct {
 	httpClient   *http.Client
 	tokenManager *auth.TokenManager
 	proxyURL     string
+
+	// countTokensUnsupported maps models for which the upstream rejected
+	// countTokens to the time to try again.
+	countTokensUnsupported sync.Map
 }
 
 // NewExecutor creates a new executor instance.
@@ -54,6 +62,14 @@ type Request struct {
 	Model   string
 	Payload []byte
 	Stream  bool
+
+	// SessionID is the upstream session ID to reuse across turns of a
+	// conversation (see StableSessionID). A random one is used when empty.
+	SessionID string
+
+	// OnUsage, if set, is called with the token usage of a successful request
+	// once the response (or the final stream chunk) has been received.
+	OnUsage func(UsageDetail)
 }
 
 // Response represents an API response.
@@ -67,6 +83,10 @@ type Response struct {
 type StreamChunk struct {
 	Data []byte
 	Err  error
+
+	// PromptTokens is the prompt token count reported with the chunk, which the
+	// upstream includes before the final chunk even though Data has it removed.
+	PromptTokens int64
 }
 
 // Execute performs a non-streaming request.
@@ -79,7 +99,7 @@ func (e *Executor) Execute(ctx context.Context, creds *auth.Credentials, req Req
 	baseURLs := e.baseURLFallbackOrder(creds)
 
 	for idx, baseURL := range baseURLs {
-		httpReq, err := e.buildRequest(ctx, creds, token, req.Model, req.Payload, false, baseURL)
+		httpReq, err := e.buildRequest(ctx, creds, token, req, false, baseURL)
 		if err != nil {
 			return nil, err
 		}
@@ -111,6 +131,10 @@ func (e *Executor) Execute(ctx context.Context, creds *auth.Credentials, req Req
 			}, fmt.Errorf("API error: status %d", httpResp.StatusCode)
 		}
 
+		if req.OnUsage != nil {
+			req.OnUsage(ParseUsage(bodyBytes))
+		}
+
 		return &Response{
 			StatusCode: httpResp.StatusCode,
 			Body:       bodyBytes,
@@ -131,7 +155,7 @@ func (e *Executor) ExecuteStream(ctx context.Context, creds *auth.Credentials, r
 	baseURLs := e.baseURLFallbackOrder(creds)
 
 	for idx, baseURL := range baseURLs {
-		httpReq, err := e.buildRequest(ctx, creds, token, req.Model, req.Payload, true, baseURL)
+		httpReq, err := e.buildRequest(ctx, creds, token, req, true, baseURL)
 		if err != nil {
 			return nil, err
 		}
@@ -163,8 +187,27 @@ func (e *Executor) ExecuteStream(ctx context.Context, creds *auth.Credentials, r
 			scanner := bufio.NewScanner(httpResp.Body)
 			scanner.Buffer(nil, StreamScannerSize)
 
+			// Stop once the client is gone, rather than block on a reader that
+			// no longer receives
+			send := func(chunk StreamChunk) bool {
+				select {
+				case out <- chunk:
+					return true
+				case <-ctx.Done():
+					return false
+				}
+			}
+
+			var usage UsageDetail
+			hasUsage := false
 			for scanner.Scan() {
 				line := scanner.Bytes()
+				// Usage is cumulative, so the last chunk that carries it is final
+				detail, ok := ParseStreamUsage(line)
+				if ok {
+					usage, hasUsage = detail, true
+				}
+
 				// Filter usage metadata for intermediate chunks
 				line = FilterSSEUsageMetadata(line)
 
@@ -173,11 +216,16 @@ func (e *Executor) ExecuteStream(ctx context.Context, creds *auth.Credentials, r
 					continue
 				}
 
-				out <- StreamChunk{Data: bytes.Clone(payload)}
+				if !send(StreamChunk{Data: bytes.Clone(payload), PromptTokens: detail.InputTokens}) {
+					break
+				}
 			}
 
-			if err := scanner.Err(); err != nil {
-				out <- StreamChunk{Err: err}
+			if err := scanner.Err(); err != nil && ctx.Err() == nil {
+				send(StreamChunk{Err: err})
+			}
+			if hasUsage && req.OnUsage != nil {
+				req.OnUsage(usage)
 			}
 		}()
 
@@ -207,7 +255,7 @@ func (e *Executor) ensureAccessToken(ctx context.Context, creds *auth.Credential
 	return creds.AccessToken, nil
 }
 
-func (e *Executor) buildRequest(ctx context.Context, creds *auth.Credentials, token, modelName string, payload []byte, stream bool, baseURL string) (*http.Request, error) {
+func (e *Executor) buildRequest(ctx context.Context, creds *auth.Credentials, token string, req Request, stream bool, baseURL string) (*http.Request, error) {
 	if token == "" {
 		return nil, fmt.Errorf("missing access token")
 	}
@@ -226,7 +274,7 @@ func (e *Executor) buildRequest(ctx context.Context, creds *auth.Credentials, to
 	}
 
 	// Transform payload for Antigravity format
-	payload = e.transformPayload(modelName, payload, creds.ProjectID)
+	payload := e.transformPayload(req.Model, req.Payload, creds.ProjectID, req.SessionID)
 
 	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, requestURL.String(), bytes.NewReader(payload))
 	if err != nil {
@@ -250,7 +298,7 @@ func (e *Executor) buildRequest(ctx context.Context, creds *auth.Credentials, to
 	return httpReq, nil
 }
 
-func (e *Executor) transformPayload(modelName string, payload []byte, projectID string) []byte {
+func (e *Executor) transformPayload(modelName string, payload []byte, projectID, sessionID string) []byte {
 	// Convert alias to internal model name
 	internalModelName := models.Alias2ModelName(modelName)
 
@@ -259,13 +307,18 @@ func (e *Executor) transformPayload(modelName string, payload []byte, projectID
 
 	if projectID != "" {
 		template, _ = sjson.Set(template, "project", projectID)
+	} else if sessionID != "" {
+		template, _ = sjson.Set(template, "project", stableProjectID(sessionID))
 	} else {
 		template, _ = sjson.Set(template, "project", generateProjectID())
 	}
 	template, _ = sjson.Set(template, "requestId", generateRequestID())
-	template, _ = sjson.Set(template, "request.sessionId", generateSessionID())
+	if sessionID != "" {
+		template, _ = sjson.Set(template, "request.sessionId", sessionID)
+	} else {
+		template, _ = sjson.Set(template, "request.sessionId", generateSessionID())
+	}
 
-	template, _ = sjson.Delete(template, "request.safetySettings")
 	template, _ = sjson.Set(template, "request.toolConfig.functionCallingConfig.mode", "VALIDATED")
 
 	// Handle thinkingLevel for non-gemini-3 models
@@ -405,6 +458,14 @@ func generateSessionID() string {
 	return "-" + strconv.FormatInt(n, 10)
 }
 
+// StableSessionID derives an upstream session ID from a conversation key so
+// that every turn of the conversation reuses the same session.
+func StableSessionID(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	n := binary.BigEndian.Uint64(sum[:8]) % 9_000_000_000_000_000_000
+	return "-" + strconv.FormatUint(n, 10)
+}
+
 func generateProjectID() string {
 	adjectives := []string{"useful", "bright", "swift", "calm", "bold"}
 	nouns := []string{"fuze", "wave", "spark", "flow", "core"}
@@ -414,6 +475,18 @@ func generateProjectID() string {
 	return adj + "-" + noun + "-" + randomPart
 }
 
+// stableProjectID derives a fallback project ID from the session ID, in the
+// same shape as generateProjectID.
+func stableProjectID(sessionID string) string {
+	adjectives := []string{"useful", "bright", "swift", "calm", "bold"}
+	nouns := []string{"fuze", "wave", "spark", "flow", "core"}
+	sum := sha256.Sum256([]byte(sessionID))
+	adj := adjectives[int(sum[0])%len(adjectives)]
+	noun := nouns[int(sum[1])%len(nouns)]
+	randomPart := hex.EncodeToString(sum[2:5])[:5]
+	return adj + "-" + noun + "-" + randomPart
+}
+
 func extractJSONPayload(line []byte) []byte {
 	trimmed := bytes.TrimSpace(line)
 	if len(trimmed) == 0 {
@@ -33,6 +33,7 @@ func ParseUsage(data []byte) UsageDetail {
 		InputTokens:     node.Get("promptTokenCount").Int(),
 		OutputTokens:    node.Get("candidatesTokenCount").Int(),
 		ReasoningTokens: node.Get("thoughtsTokenCount").Int(),
+		CachedTokens:    node.Get("cachedContentTokenCount").Int(),
 		TotalTokens:     node.Get("totalTokenCount").Int(),
 	}
 	if detail.TotalTokens == 0 {
@@ -61,6 +62,7 @@ func ParseStreamUsage(line []byte) (UsageDetail, bool) {
 		InputTokens:     node.Get("promptTokenCount").Int(),
 		OutputTokens:    node.Get("candidatesTokenCount").Int(),
 		ReasoningTokens: node.Get("thoughtsTokenCount").Int(),
+		CachedTokens:    node.Get("cachedContentTokenCount").Int(),
 		TotalTokens:     node.Get("totalTokenCount").Int(),
 	}
 	if detail.TotalTokens == 0 {
@@ -0,0 +1,272 @@
+// Package files stores files uploaded through the Files API, so that requests
+// can reference them by ID instead of re-sending their content.
+//
+// Files are kept in a directory per owner (an API key), as a content file and
+// a JSON metadata file named after the file ID.
+package files
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// idPrefix prefixes file IDs.
+const idPrefix = "file-"
+
+var (
+	// ErrNotFound is returned for file IDs that do not exist for an owner.
+	ErrNotFound = errors.New("file not found")
+
+	// ErrTooLarge is returned when an upload exceeds the maximum file size.
+	ErrTooLarge = errors.New("file exceeds the maximum size")
+
+	// ErrQuotaExceeded is returned when an upload would exceed the owner's
+	// storage quota.
+	ErrQuotaExceeded = errors.New("storage quota exceeded")
+)
+
+// File is the metadata of a stored file.
+type File struct {
+	ID        string    `json:"id"`
+	Filename  string    `json:"filename"`
+	MIMEType  string    `json:"mime_type"`
+	Purpose   string    `json:"purpose,omitempty"`
+	Bytes     int64     `json:"bytes"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Store keeps uploaded files on disk.
+type Store struct {
+	dir     string
+	maxSize int64
+
+	mu sync.Mutex
+}
+
+// NewStore creates a store in dir, creating the directory if needed. Uploads
+// larger than maxSize bytes are rejected (0 = unlimited).
+func NewStore(dir string, maxSize int64) (*Store, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &Store{dir: dir, maxSize: maxSize}, nil
+}
+
+// Create stores the content read from r for owner. quota is the owner's
+// storage quota in bytes (0 = unlimited).
+func (s *Store) Create(owner, filename, mimeType, purpose string, r io.Reader, quota int64) (*File, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	dir := s.ownerDir(owner)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("create file directory: %w", err)
+	}
+
+	limit := s.maxSize
+	if quota > 0 {
+		remaining := quota - s.usageLocked(owner)
+		if remaining <= 0 {
+			return nil, ErrQuotaExceeded
+		}
+		if limit == 0 || remaining < limit {
+			limit = remaining
+		}
+	}
+
+	id, err := newID()
+	if err != nil {
+		return nil, err
+	}
+
+	// Write the content first, so that metadata never points to a partial file
+	tmp, err := os.CreateTemp(dir, ".tmp-*")
+	if err != nil {
+		return nil, fmt.Errorf("create file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	reader := r
+	if limit > 0 {
+		reader = io.LimitReader(r, limit+1)
+	}
+	size, err := io.Copy(tmp, reader)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("write file: %w", err)
+	}
+	if limit > 0 && size > limit {
+		if limit == s.maxSize {
+			return nil, ErrTooLarge
+		}
+		return nil, ErrQuotaExceeded
+	}
+
+	file := &File{
+		ID:        id,
+		Filename:  filepath.Base(filename),
+		MIMEType:  mimeType,
+		Purpose:   purpose,
+		Bytes:     size,
+		CreatedAt: time.Now().UTC(),
+	}
+	meta, err := json.Marshal(file)
+	if err != nil {
+		return nil, fmt.Errorf("marshal file metadata: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), s.contentPath(owner, id)); err != nil {
+		return nil, fmt.Errorf("store file: %w", err)
+	}
+	if err := os.WriteFile(s.metaPath(owner, id), meta, 0600); err != nil {
+		_ = os.Remove(s.contentPath(owner, id))
+		return nil, fmt.Errorf("write file metadata: %w", err)
+	}
+	return file, nil
+}
+
+// Get returns the metadata of a file.
+func (s *Store) Get(owner, id string) (*File, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.getLocked(owner, id)
+}
+
+// Content returns the metadata and content of a file.
+func (s *Store) Content(owner, id string) (*File, []byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	file, err := s.getLocked(owner, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	data, err := os.ReadFile(s.contentPath(owner, id))
+	if err != nil {
+		return nil, nil, fmt.Errorf("read file: %w", err)
+	}
+	return file, data, nil
+}
+
+// List returns the files of owner, newest first.
+func (s *Store) List(owner string) []*File {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.listLocked(owner)
+}
+
+// Delete removes a file.
+func (s *Store) Delete(owner, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.getLocked(owner, id); err != nil {
+		return err
+	}
+	if err := os.Remove(s.metaPath(owner, id)); err != nil {
+		return fmt.Errorf("delete file metadata: %w", err)
+	}
+	if err := os.Remove(s.contentPath(owner, id)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("delete file: %w", err)
+	}
+	return nil
+}
+
+// Usage returns the number of bytes stored for owner.
+func (s *Store) Usage(owner string) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.usageLocked(owner)
+}
+
+func (s *Store) getLocked(owner, id string) (*File, error) {
+	if !validID(id) {
+		return nil, ErrNotFound
+	}
+	data, err := os.ReadFile(s.metaPath(owner, id))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("read file metadata: %w", err)
+	}
+	var file File
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("parse file metadata: %w", err)
+	}
+	return &file, nil
+}
+
+func (s *Store) listLocked(owner string) []*File {
+	entries, err := os.ReadDir(s.ownerDir(owner))
+	if err != nil {
+		return nil
+	}
+	var list []*File
+	for _, entry := range entries {
+		id, ok := strings.CutSuffix(entry.Name(), ".json")
+		if !ok {
+			continue
+		}
+		if file, err := s.getLocked(owner, id); err == nil {
+			list = append(list, file)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.After(list[j].CreatedAt) })
+	return list
+}
+
+func (s *Store) usageLocked(owner string) int64 {
+	var total int64
+	for _, file := range s.listLocked(owner) {
+		total += file.Bytes
+	}
+	return total
+}
+
+// ownerDir returns the directory of an owner. Owners are hashed so that API
+// keys do not appear in paths.
+func (s *Store) ownerDir(owner string) string {
+	sum := sha256.Sum256([]byte(owner))
+	return filepath.Join(s.dir, hex.EncodeToString(sum[:16]))
+}
+
+func (s *Store) contentPath(owner, id string) string {
+	return filepath.Join(s.ownerDir(owner), id)
+}
+
+func (s *Store) metaPath(owner, id string) string {
+	return filepath.Join(s.ownerDir(owner), id+".json")
+}
+
+// newID returns a random file ID.
+func newID() (string, error) {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generate file ID: %w", err)
+	}
+	return idPrefix + hex.EncodeToString(b), nil
+}
+
+// validID reports whether id has the form of a file ID, which keeps IDs from
+// escaping the owner's directory.
+func validID(id string) bool {
+	hexPart, ok := strings.CutPrefix(id, idPrefix)
+	if !ok || len(hexPart) != 24 {
+		return false
+	}
+	_, err := hex.DecodeString(hexPart)
+	return err == nil
+}
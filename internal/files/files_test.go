@@ -0,0 +1,150 @@
+package files
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestValidID(t *testing.T) {
+	id, err := newID()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		id   string
+		want bool
+	}{
+		{id, true},
+		{"file-0123456789abcdef01234567", true},
+		{"", false},
+		{"file-", false},
+		{"0123456789abcdef01234567", false},
+		{"file-0123456789abcdef0123456", false},
+		{"file-0123456789abcdef012345678", false},
+		{"file-0123456789abcdef0123456g", false},
+		{"../file-0123456789abcdef01234567", false},
+		{"file-0123456789abcdef01234567/..", false},
+		{"file-../../../../etc/passwd0000", false},
+		{"file-..%2f..%2f..%2fetc%2fpass", false},
+		{"/etc/passwd", false},
+		{"..", false},
+	}
+	for _, tt := range tests {
+		if got := validID(tt.id); got != tt.want {
+			t.Errorf("validID(%q) = %v; want %v", tt.id, got, tt.want)
+		}
+	}
+}
+
+func TestStoreRejectsPathLikeIDs(t *testing.T) {
+	store, err := NewStore(t.TempDir(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Create("owner", "a.txt", "text/plain", "", strings.NewReader("hello"), 0); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, id := range []string{"..", "../owner", "file-../../x", "/etc/passwd", ""} {
+		if _, err := store.Get("owner", id); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Get(%q) error = %v; want ErrNotFound", id, err)
+		}
+		if _, _, err := store.Content("owner", id); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Content(%q) error = %v; want ErrNotFound", id, err)
+		}
+		if err := store.Delete("owner", id); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Delete(%q) error = %v; want ErrNotFound", id, err)
+		}
+	}
+}
+
+func TestStoreOwnerScoping(t *testing.T) {
+	store, err := NewStore(t.TempDir(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := store.Create("alice", "a.txt", "text/plain", "", strings.NewReader("secret"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		owner   string
+		wantErr error
+	}{
+		{"owner", "alice", nil},
+		{"other owner", "bob", ErrNotFound},
+		{"empty owner", "", ErrNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := store.Get(tt.owner, file.ID); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Get() error = %v; want %v", err, tt.wantErr)
+			}
+			if _, _, err := store.Content(tt.owner, file.ID); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Content() error = %v; want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				if err := store.Delete(tt.owner, file.ID); !errors.Is(err, tt.wantErr) {
+					t.Errorf("Delete() error = %v; want %v", err, tt.wantErr)
+				}
+				if list := store.List(tt.owner); len(list) != 0 {
+					t.Errorf("List() = %d files; want none", len(list))
+				}
+			}
+		})
+	}
+
+	// The file survives the other owners' delete attempts
+	if _, data, err := store.Content("alice", file.ID); err != nil || string(data) != "secret" {
+		t.Errorf("Content() = %q, %v; want the stored content", data, err)
+	}
+}
+
+func TestStoreLimits(t *testing.T) {
+	tests := []struct {
+		name    string
+		maxSize int64
+		quota   int64
+		stored  []int // Sizes of earlier uploads
+		size    int
+		wantErr error
+	}{
+		{"unlimited", 0, 0, []int{100}, 1000, nil},
+		{"within quota", 0, 100, []int{40}, 60, nil},
+		{"quota overflow", 0, 100, []int{40}, 61, ErrQuotaExceeded},
+		{"quota used up", 0, 100, []int{100}, 1, ErrQuotaExceeded},
+		{"max size", 50, 0, nil, 50, nil},
+		{"over max size", 50, 0, nil, 51, ErrTooLarge},
+		{"over max size within quota", 50, 1000, nil, 51, ErrTooLarge},
+		{"quota tighter than max size", 50, 100, []int{40, 40}, 21, ErrQuotaExceeded},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store, err := NewStore(t.TempDir(), tt.maxSize)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, size := range tt.stored {
+				if _, err := store.Create("owner", "f", "text/plain", "", strings.NewReader(strings.Repeat("x", size)), 0); err != nil {
+					t.Fatal(err)
+				}
+			}
+			before := store.Usage("owner")
+
+			_, err = store.Create("owner", "f", "text/plain", "", strings.NewReader(strings.Repeat("x", tt.size)), tt.quota)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Create() error = %v; want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				// Rejected uploads leave nothing behind
+				if usage := store.Usage("owner"); usage != before {
+					t.Errorf("Usage() = %d after rejected upload; want %d", usage, before)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// audioFormats maps OpenAI input_audio formats to the MIME types the upstream
+// accepts.
+var audioFormats = map[string]string{
+	"wav":  "audio/wav",
+	"mp3":  "audio/mp3",
+	"aiff": "audio/aiff",
+	"aac":  "audio/aac",
+	"ogg":  "audio/ogg",
+	"flac": "audio/flac",
+}
+
+// AudioMIMEType returns the MIME type of an input_audio format.
+func AudioMIMEType(format string) (string, bool) {
+	mimeType, ok := audioFormats[strings.ToLower(format)]
+	return mimeType, ok
+}
+
+// AudioDuration returns the playing time of WAV or MP3 audio. MP3 durations
+// are estimated from the bitrate of the first frame. It reports false for
+// other formats and for data it cannot parse.
+func AudioDuration(format string, data []byte) (time.Duration, bool) {
+	switch strings.ToLower(format) {
+	case "wav":
+		return wavDuration(data)
+	case "mp3":
+		return mp3Duration(data)
+	}
+	return 0, false
+}
+
+// wavDuration reads the byte rate and data size from a RIFF/WAVE header.
+func wavDuration(data []byte) (time.Duration, bool) {
+	if len(data) < 12 || string(data[0:4]) != "RIFF" || string(data[8:12]) != "WAVE" {
+		return 0, false
+	}
+	var byteRate uint32
+	for offset := 12; offset+8 <= len(data); {
+		id := string(data[offset : offset+4])
+		size := binary.LittleEndian.Uint32(data[offset+4 : offset+8])
+		body := offset + 8
+		switch id {
+		case "fmt ":
+			if body+12 > len(data) {
+				return 0, false
+			}
+			byteRate = binary.LittleEndian.Uint32(data[body+8 : body+12])
+		case "data":
+			if byteRate == 0 {
+				return 0, false
+			}
+			// Streamed WAVs may leave the data size unset
+			available := uint64(len(data) - body)
+			dataSize := min(uint64(size), available)
+			return time.Duration(dataSize * uint64(time.Second) / uint64(byteRate)), true
+		}
+		offset = body + int(size) + int(size%2)
+	}
+	return 0, false
+}
+
+// mp3Bitrates are the MPEG Layer III bitrates in kbit/s, for MPEG-1 and for
+// MPEG-2/2.5, by bitrate index.
+var mp3Bitrates = [2][16]int{
+	{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 0},
+	{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, 0},
+}
+
+// mp3Duration estimates the playing time of MP3 audio from the bitrate of its
+// first frame, skipping a leading ID3v2 tag.
+func mp3Duration(data []byte) (time.Duration, bool) {
+	if len(data) >= 10 && bytes.HasPrefix(data, []byte("ID3")) {
+		tagSize := int(data[6]&0x7f)<<21 | int(data[7]&0x7f)<<14 | int(data[8]&0x7f)<<7 | int(data[9]&0x7f)
+		data = data[min(10+tagSize, len(data)):]
+	}
+	for i := 0; i+4 <= len(data); i++ {
+		if data[i] != 0xff || data[i+1]&0xe0 != 0xe0 {
+			continue
+		}
+		version := (data[i+1] >> 3) & 0x03 // 3 = MPEG-1, 2 = MPEG-2, 0 = MPEG-2.5
+		layer := (data[i+1] >> 1) & 0x03   // 1 = Layer III
+		bitrateIndex := data[i+2] >> 4
+		if version == 1 || layer != 1 {
+			continue
+		}
+		table := 1
+		if version == 3 {
+			table = 0
+		}
+		bitrate := mp3Bitrates[table][bitrateIndex]
+		if bitrate == 0 {
+			continue
+		}
+		bits := uint64(len(data)-i) * 8
+		return time.Duration(bits * uint64(time.Second) / uint64(bitrate*1000)), true
+	}
+	return 0, false
+}
+
+// CheckAudio validates base64-decoded input_audio against the size and
+// duration limits (0 = unlimited). WAV and MP3 data must be parseable, so
+// that their duration is known. Other formats have no duration check, so they
+// are rejected while a duration limit is set.
+func CheckAudio(format string, data []byte, maxBytes int64, maxDuration time.Duration) error {
+	if _, ok := AudioMIMEType(format); !ok {
+		return fmt.Errorf("unsupported audio format %q", format)
+	}
+	if len(data) == 0 {
+		return fmt.Errorf("audio data is empty")
+	}
+	if maxBytes > 0 && int64(len(data)) > maxBytes {
+		return fmt.Errorf("audio exceeds %d bytes", maxBytes)
+	}
+	duration, ok := AudioDuration(format, data)
+	if !ok && (strings.EqualFold(format, "wav") || strings.EqualFold(format, "mp3")) {
+		return fmt.Errorf("audio data is not valid %s", strings.ToLower(format))
+	}
+	if !ok && maxDuration > 0 {
+		return fmt.Errorf("audio format %q is not supported while a duration limit is set; use wav or mp3", format)
+	}
+	if maxDuration > 0 && duration > maxDuration {
+		return fmt.Errorf("audio is %s long, exceeding the limit of %s", duration.Round(time.Second), maxDuration)
+	}
+	return nil
+}
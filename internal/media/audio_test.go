@@ -0,0 +1,100 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+// wavFile builds a PCM WAV file holding dataSize bytes at byteRate. A
+// declaredSize other than dataSize writes that size into the data chunk.
+func wavFile(byteRate uint32, dataSize, declaredSize int) []byte {
+	var b bytes.Buffer
+	b.WriteString("RIFF")
+	binary.Write(&b, binary.LittleEndian, uint32(36+dataSize))
+	b.WriteString("WAVE")
+	b.WriteString("fmt ")
+	binary.Write(&b, binary.LittleEndian, uint32(16))
+	binary.Write(&b, binary.LittleEndian, uint16(1))  // PCM
+	binary.Write(&b, binary.LittleEndian, uint16(1))  // Channels
+	binary.Write(&b, binary.LittleEndian, byteRate/2) // Sample rate
+	binary.Write(&b, binary.LittleEndian, byteRate)   // Byte rate
+	binary.Write(&b, binary.LittleEndian, uint16(2))  // Block align
+	binary.Write(&b, binary.LittleEndian, uint16(16)) // Bits per sample
+	b.WriteString("data")
+	binary.Write(&b, binary.LittleEndian, uint32(declaredSize))
+	b.Write(make([]byte, dataSize))
+	return b.Bytes()
+}
+
+// mp3File builds size bytes of MPEG-1 Layer III audio at 128 kbit/s, after an
+// optional ID3v2 tag of tagSize bytes.
+func mp3File(size, tagSize int) []byte {
+	var b bytes.Buffer
+	if tagSize > 0 {
+		b.Write([]byte{'I', 'D', '3', 4, 0, 0, 0, 0, byte(tagSize >> 7), byte(tagSize & 0x7f)})
+		b.Write(make([]byte, tagSize))
+	}
+	frames := make([]byte, size)
+	copy(frames, []byte{0xff, 0xfb, 0x90, 0x00})
+	b.Write(frames)
+	return b.Bytes()
+}
+
+func TestAudioDuration(t *testing.T) {
+	tests := []struct {
+		name   string
+		format string
+		data   []byte
+		want   time.Duration
+		ok     bool
+	}{
+		{"wav", "wav", wavFile(32000, 64000, 64000), 2 * time.Second, true},
+		{"wav upper case format", "WAV", wavFile(32000, 16000, 16000), 500 * time.Millisecond, true},
+		{"streamed wav without data size", "wav", wavFile(32000, 32000, 0xffffffff), time.Second, true},
+		{"wav with zero byte rate", "wav", wavFile(0, 100, 100), 0, false},
+		{"not riff", "wav", []byte("RIFX....WAVE"), 0, false},
+		{"truncated wav", "wav", []byte("RIFF"), 0, false},
+		{"mp3", "mp3", mp3File(32000, 0), 2 * time.Second, true},
+		{"mp3 with id3 tag", "mp3", mp3File(16000, 200), time.Second, true},
+		{"mp3 without frames", "mp3", make([]byte, 1000), 0, false},
+		{"unchecked format", "ogg", []byte("OggS"), 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := AudioDuration(tt.format, tt.data)
+			if got != tt.want || ok != tt.ok {
+				t.Errorf("AudioDuration() = %v, %v; want %v, %v", got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestCheckAudio(t *testing.T) {
+	tests := []struct {
+		name        string
+		format      string
+		data        []byte
+		maxBytes    int64
+		maxDuration time.Duration
+		wantErr     bool
+	}{
+		{"within limits", "wav", wavFile(32000, 32000, 32000), 1 << 20, time.Minute, false},
+		{"too long", "wav", wavFile(32000, 64000, 64000), 0, time.Second, true},
+		{"too large", "mp3", mp3File(32000, 0), 1000, 0, true},
+		{"invalid wav", "wav", []byte("not audio"), 0, 0, true},
+		{"empty", "mp3", nil, 0, 0, true},
+		{"unknown format", "midi", []byte("MThd"), 0, 0, true},
+		{"unchecked format with duration limit", "flac", []byte("fLaC"), 0, time.Minute, true},
+		{"unchecked format without duration limit", "flac", []byte("fLaC"), 0, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckAudio(tt.format, tt.data, tt.maxBytes, tt.maxDuration)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("CheckAudio() error = %v; want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,232 @@
+// Package media downloads remote images and documents referenced by requests,
+// so that they can be sent upstream as inline data.
+package media
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/anthropics/antigravity-wrapper/internal/responsecache"
+)
+
+// maxRedirects is the number of redirects followed for a download.
+const maxRedirects = 5
+
+// imageTypes are the image MIME types the upstream accepts.
+var imageTypes = map[string]bool{
+	"image/png":  true,
+	"image/jpeg": true,
+	"image/webp": true,
+	"image/gif":  true,
+	"image/heic": true,
+	"image/heif": true,
+}
+
+// documentTypes are the document MIME types the upstream accepts.
+var documentTypes = map[string]bool{
+	"application/pdf": true,
+	"text/plain":      true,
+	"text/markdown":   true,
+	"text/csv":        true,
+	"text/html":       true,
+}
+
+// ErrBlockedAddress is returned when a URL resolves to an address that the
+// fetcher may not connect to.
+var ErrBlockedAddress = errors.New("address is not allowed")
+
+// Options configures a Fetcher.
+type Options struct {
+	// MaxBytes is the largest download accepted.
+	MaxBytes int64
+
+	// Timeout bounds each download, including redirects.
+	Timeout time.Duration
+
+	// AllowPrivate permits connections to loopback, private, link-local and
+	// other non-public addresses.
+	AllowPrivate bool
+
+	// CacheMaxBytes is the largest download kept in the cache, so that the
+	// cache's memory stays bounded (0 = no limit).
+	CacheMaxBytes int64
+}
+
+// Fetcher downloads remote images and documents. Downloads are cached by URL
+// hash.
+type Fetcher struct {
+	client        *http.Client
+	maxBytes      int64
+	cacheMaxBytes int64
+	cache         responsecache.Store
+}
+
+// NewFetcher creates a fetcher. cache may be nil to disable caching.
+func NewFetcher(opts Options, cache responsecache.Store) *Fetcher {
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	if !opts.AllowPrivate {
+		// Check the resolved address of every connection, including those
+		// made for redirects, so that DNS names cannot point inside the
+		// private network
+		dialer.Control = func(_, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !isPublic(ip) {
+				return fmt.Errorf("%s: %w", host, ErrBlockedAddress)
+			}
+			return nil
+		}
+	}
+
+	// Proxies are not used, since they would connect on the fetcher's behalf
+	// and bypass the address checks
+	client := &http.Client{
+		Timeout: opts.Timeout,
+		Transport: &http.Transport{
+			DialContext:           dialer.DialContext,
+			ForceAttemptHTTP2:     true,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ResponseHeaderTimeout: opts.Timeout,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxRedirects {
+				return fmt.Errorf("stopped after %d redirects", maxRedirects)
+			}
+			if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+				return fmt.Errorf("unsupported redirect scheme: %s", req.URL.Scheme)
+			}
+			return nil
+		},
+	}
+
+	return &Fetcher{client: client, maxBytes: opts.MaxBytes, cacheMaxBytes: opts.CacheMaxBytes, cache: cache}
+}
+
+// IsRemote reports whether rawURL is an http or https URL.
+func IsRemote(rawURL string) bool {
+	return strings.HasPrefix(rawURL, "http://") || strings.HasPrefix(rawURL, "https://")
+}
+
+// FetchImage downloads the image at rawURL and returns its MIME type and
+// base64-encoded data.
+func (f *Fetcher) FetchImage(ctx context.Context, rawURL string) (mimeType, data string, err error) {
+	return f.fetch(ctx, rawURL, "image", imageTypes)
+}
+
+// FetchDocument downloads the PDF or text document at rawURL and returns its
+// MIME type and base64-encoded data.
+func (f *Fetcher) FetchDocument(ctx context.Context, rawURL string) (mimeType, data string, err error) {
+	return f.fetch(ctx, rawURL, "document", documentTypes)
+}
+
+// fetch downloads a kind of media limited to the given MIME types.
+func (f *Fetcher) fetch(ctx context.Context, rawURL, kind string, types map[string]bool) (mimeType, data string, err error) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return "", "", fmt.Errorf("invalid %s URL: %s", kind, rawURL)
+	}
+
+	sum := sha256.Sum256([]byte(rawURL))
+	key := hex.EncodeToString(sum[:])
+	if f.cache != nil {
+		if cached, ok := f.cache.Get(key); ok {
+			if mimeType, data, ok := strings.Cut(string(cached), "\n"); ok && types[mimeType] {
+				return mimeType, data, nil
+			}
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return "", "", fmt.Errorf("create %s request: %w", kind, err)
+	}
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return "", "", fmt.Errorf("fetch %s %s: %w", kind, rawURL, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", "", fmt.Errorf("fetch %s %s: status %d", kind, rawURL, resp.StatusCode)
+	}
+	if f.maxBytes > 0 && resp.ContentLength > f.maxBytes {
+		return "", "", fmt.Errorf("%s %s exceeds %d bytes", kind, rawURL, f.maxBytes)
+	}
+
+	var body io.Reader = resp.Body
+	if f.maxBytes > 0 {
+		body = io.LimitReader(resp.Body, f.maxBytes+1)
+	}
+	raw, err := io.ReadAll(body)
+	if err != nil {
+		return "", "", fmt.Errorf("read %s %s: %w", kind, rawURL, err)
+	}
+	if f.maxBytes > 0 && int64(len(raw)) > f.maxBytes {
+		return "", "", fmt.Errorf("%s %s exceeds %d bytes", kind, rawURL, f.maxBytes)
+	}
+
+	mimeType, _, _ = mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if !types[mimeType] {
+		// Servers often send generic types; trust the content instead
+		mimeType, _, _ = mime.ParseMediaType(http.DetectContentType(raw))
+	}
+	if !types[mimeType] {
+		return "", "", fmt.Errorf("unsupported %s type for %s: %s", kind, rawURL, mimeType)
+	}
+
+	data = base64.StdEncoding.EncodeToString(raw)
+	if f.cache != nil && (f.cacheMaxBytes <= 0 || int64(len(raw)) <= f.cacheMaxBytes) {
+		f.cache.Set(key, []byte(mimeType+"\n"+data))
+	}
+	return mimeType, data, nil
+}
+
+// isPublic reports whether ip is a public unicast address.
+func isPublic(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return false
+	}
+	for _, block := range reservedBlocks {
+		if block.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// reservedBlocks are non-public ranges not covered by the net.IP predicates.
+var reservedBlocks = func() []*net.IPNet {
+	var blocks []*net.IPNet
+	for _, cidr := range []string{
+		"0.0.0.0/8",      // "This" network
+		"100.64.0.0/10",  // Carrier-grade NAT
+		"192.0.0.0/24",   // IETF protocol assignments
+		"198.18.0.0/15",  // Benchmarking
+		"240.0.0.0/4",    // Reserved
+		"64:ff9b::/96",   // NAT64, may reach private IPv4 addresses
+		"64:ff9b:1::/48", // Local-use NAT64
+		"2002::/16",      // 6to4, may embed private IPv4 addresses
+		"2001::/32",      // Teredo
+	} {
+		_, block, _ := net.ParseCIDR(cidr)
+		blocks = append(blocks, block)
+	}
+	return blocks
+}()
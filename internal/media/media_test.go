@@ -0,0 +1,82 @@
+package media
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestIsPublic(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"8.8.8.8", true},
+		{"1.1.1.1", true},
+		{"2606:4700:4700::1111", true},
+		{"127.0.0.1", false},
+		{"10.0.0.1", false},
+		{"172.16.5.4", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"0.0.0.0", false},
+		{"100.64.0.1", false},
+		{"198.18.0.1", false},
+		{"240.0.0.1", false},
+		{"224.0.0.1", false},
+		{"::1", false},
+		{"::", false},
+		{"fc00::1", false},
+		{"fe80::1", false},
+		{"::ffff:127.0.0.1", false},
+		{"::ffff:10.0.0.1", false},
+		{"::ffff:169.254.169.254", false},
+		{"64:ff9b::a00:1", false},
+		{"64:ff9b::7f00:1", false},
+		{"64:ff9b:1::1", false},
+		{"2002:a00:1::1", false},
+		{"2001:0:a00:1::1", false},
+	}
+	for _, tt := range tests {
+		ip := net.ParseIP(tt.ip)
+		if ip == nil {
+			t.Fatalf("invalid test IP %q", tt.ip)
+		}
+		if got := isPublic(ip); got != tt.want {
+			t.Errorf("isPublic(%s) = %v; want %v", tt.ip, got, tt.want)
+		}
+	}
+}
+
+func TestFetchBlocksPrivateAddresses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Write([]byte("\x89PNG\r\n\x1a\n"))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name         string
+		allowPrivate bool
+		wantErr      error
+	}{
+		{"loopback blocked", false, ErrBlockedAddress},
+		{"loopback allowed", true, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fetcher := NewFetcher(Options{Timeout: 5 * time.Second, AllowPrivate: tt.allowPrivate}, nil)
+			_, _, err := fetcher.FetchImage(context.Background(), server.URL)
+			if tt.wantErr == nil && err != nil {
+				t.Fatalf("FetchImage() error = %v", err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("FetchImage() error = %v; want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,146 @@
+// Package metrics provides a minimal in-process metrics registry exposed in the
+// Prometheus text format.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Labels are the label names and values attached to a metric sample.
+type Labels map[string]string
+
+// kind identifies how a metric family is exposed.
+type kind string
+
+const (
+	kindCounter kind = "counter"
+	kindGauge   kind = "gauge"
+	kindSummary kind = "summary"
+)
+
+// family holds all samples of one metric name.
+type family struct {
+	kind    kind
+	help    string
+	samples map[string]float64 // keyed by rendered label set
+	counts  map[string]uint64  // summary observation counts
+}
+
+// Registry stores metric values.
+type Registry struct {
+	mu       sync.Mutex
+	families map[string]*family
+}
+
+// NewRegistry creates an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{families: make(map[string]*family)}
+}
+
+// global registry instance
+var globalRegistry = NewRegistry()
+
+// Default returns the global registry.
+func Default() *Registry {
+	return globalRegistry
+}
+
+// AddCounter increments a counter by delta.
+func (r *Registry) AddCounter(name, help string, labels Labels, delta float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.family(name, help, kindCounter).samples[renderLabels(labels)] += delta
+}
+
+// SetGauge sets a gauge to value.
+func (r *Registry) SetGauge(name, help string, labels Labels, value float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.family(name, help, kindGauge).samples[renderLabels(labels)] = value
+}
+
+// Observe records a value in a summary (exposed as _sum and _count).
+func (r *Registry) Observe(name, help string, labels Labels, value float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	f := r.family(name, help, kindSummary)
+	key := renderLabels(labels)
+	f.samples[key] += value
+	f.counts[key]++
+}
+
+// WriteText writes all metrics in the Prometheus text exposition format.
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	names := make([]string, 0, len(r.families))
+	for name := range r.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	for _, name := range names {
+		f := r.families[name]
+		fmt.Fprintf(&b, "# HELP %s %s\n", name, f.help)
+		fmt.Fprintf(&b, "# TYPE %s %s\n", name, f.kind)
+
+		keys := make([]string, 0, len(f.samples))
+		for key := range f.samples {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			if f.kind == kindSummary {
+				fmt.Fprintf(&b, "%s_sum%s %g\n", name, key, f.samples[key])
+				fmt.Fprintf(&b, "%s_count%s %d\n", name, key, f.counts[key])
+				continue
+			}
+			fmt.Fprintf(&b, "%s%s %g\n", name, key, f.samples[key])
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// family returns the family for name, creating it if needed. Caller must hold the lock.
+func (r *Registry) family(name, help string, k kind) *family {
+	f, ok := r.families[name]
+	if !ok {
+		f = &family{
+			kind:    k,
+			help:    help,
+			samples: make(map[string]float64),
+			counts:  make(map[string]uint64),
+		}
+		r.families[name] = f
+	}
+	return f
+}
+
+// renderLabels formats labels as {a="1",b="2"} with sorted names.
+func renderLabels(labels Labels) string {
+	if len(labels) == 0 {
+		return ""
+	}
+
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		value := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(labels[name])
+		parts = append(parts, fmt.Sprintf(`%s="%s"`, name, value))
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
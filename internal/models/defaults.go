@@ -54,87 +54,101 @@ var modelConfigs = map[string]*ModelConfig{
 	},
 }
 
+// Context windows of the model families, in tokens.
+const (
+	geminiContextWindow = 1048576
+	claudeContextWindow = 200000
+)
+
 // loadDefaultModels populates the registry with known models.
 func (r *Registry) loadDefaultModels() {
 	now := time.Now().Unix()
 	defaultModels := []*ModelInfo{
 		{
-			ID:          "gemini-2.5-flash",
-			Object:      "model",
-			Created:     now,
-			OwnedBy:     "antigravity",
-			Type:        "antigravity",
-			DisplayName: "Gemini 2.5 Flash",
-			Name:        "models/gemini-2.5-flash",
+			ID:            "gemini-2.5-flash",
+			Object:        "model",
+			Created:       now,
+			OwnedBy:       "antigravity",
+			Type:          "antigravity",
+			DisplayName:   "Gemini 2.5 Flash",
+			ContextWindow: geminiContextWindow,
+			Name:          "models/gemini-2.5-flash",
 		},
 		{
-			ID:          "gemini-2.5-flash-thinking",
-			Object:      "model",
-			Created:     now,
-			OwnedBy:     "antigravity",
-			Type:        "antigravity",
-			DisplayName: "Gemini 2.5 Flash (Thinking)",
-			Name:        "models/gemini-2.5-flash",
-			Thinking:    &ThinkingSupport{Min: 0, Max: 24576, ZeroAllowed: true, DynamicAllowed: true},
+			ID:            "gemini-2.5-flash-thinking",
+			Object:        "model",
+			Created:       now,
+			OwnedBy:       "antigravity",
+			Type:          "antigravity",
+			DisplayName:   "Gemini 2.5 Flash (Thinking)",
+			ContextWindow: geminiContextWindow,
+			Name:          "models/gemini-2.5-flash",
+			Thinking:      &ThinkingSupport{Min: 0, Max: 24576, ZeroAllowed: true, DynamicAllowed: true},
 		},
 		{
-			ID:          "gemini-3-flash",
-			Object:      "model",
-			Created:     now,
-			OwnedBy:     "antigravity",
-			Type:        "antigravity",
-			DisplayName: "Gemini 3 Flash",
-			Name:        "models/gemini-3-flash",
-			Thinking:    &ThinkingSupport{Min: 128, Max: 32768, ZeroAllowed: false, DynamicAllowed: true},
+			ID:            "gemini-3-flash",
+			Object:        "model",
+			Created:       now,
+			OwnedBy:       "antigravity",
+			Type:          "antigravity",
+			DisplayName:   "Gemini 3 Flash",
+			ContextWindow: geminiContextWindow,
+			Name:          "models/gemini-3-flash",
+			Thinking:      &ThinkingSupport{Min: 128, Max: 32768, ZeroAllowed: false, DynamicAllowed: true},
 		},
 		{
-			ID:          "gemini-3-flash-thinking",
-			Object:      "model",
-			Created:     now,
-			OwnedBy:     "antigravity",
-			Type:        "antigravity",
-			DisplayName: "Gemini 3 Flash (Thinking)",
-			Name:        "models/gemini-3-flash",
-			Thinking:    &ThinkingSupport{Min: 128, Max: 32768, ZeroAllowed: false, DynamicAllowed: true},
+			ID:            "gemini-3-flash-thinking",
+			Object:        "model",
+			Created:       now,
+			OwnedBy:       "antigravity",
+			Type:          "antigravity",
+			DisplayName:   "Gemini 3 Flash (Thinking)",
+			ContextWindow: geminiContextWindow,
+			Name:          "models/gemini-3-flash",
+			Thinking:      &ThinkingSupport{Min: 128, Max: 32768, ZeroAllowed: false, DynamicAllowed: true},
 		},
 		{
-			ID:          "gemini-2.5-flash-lite",
-			Object:      "model",
-			Created:     now,
-			OwnedBy:     "antigravity",
-			Type:        "antigravity",
-			DisplayName: "Gemini 2.5 Flash Lite",
-			Name:        "models/gemini-2.5-flash-lite",
+			ID:            "gemini-2.5-flash-lite",
+			Object:        "model",
+			Created:       now,
+			OwnedBy:       "antigravity",
+			Type:          "antigravity",
+			DisplayName:   "Gemini 2.5 Flash Lite",
+			ContextWindow: geminiContextWindow,
+			Name:          "models/gemini-2.5-flash-lite",
 		},
 		{
-			ID:          "gemini-2.5-flash-lite-thinking",
-			Object:      "model",
-			Created:     now,
-			OwnedBy:     "antigravity",
-			Type:        "antigravity",
-			DisplayName: "Gemini 2.5 Flash Lite (Thinking)",
-			Name:        "models/gemini-2.5-flash-lite",
-			Thinking:    &ThinkingSupport{Min: 0, Max: 24576, ZeroAllowed: true, DynamicAllowed: true},
+			ID:            "gemini-2.5-flash-lite-thinking",
+			Object:        "model",
+			Created:       now,
+			OwnedBy:       "antigravity",
+			Type:          "antigravity",
+			DisplayName:   "Gemini 2.5 Flash Lite (Thinking)",
+			ContextWindow: geminiContextWindow,
+			Name:          "models/gemini-2.5-flash-lite",
+			Thinking:      &ThinkingSupport{Min: 0, Max: 24576, ZeroAllowed: true, DynamicAllowed: true},
 		},
 		{
-			ID:          "gemini-3-pro-high",
-			Object:      "model",
-			Created:     now,
-			OwnedBy:     "antigravity",
-			Type:        "antigravity",
-			DisplayName: "Gemini 3 Pro High",
-			Name:        "models/gemini-3-pro-high",
-			Thinking:    &ThinkingSupport{Min: 128, Max: 32768, ZeroAllowed: false, DynamicAllowed: true},
+			ID:            "gemini-3-pro-high",
+			Object:        "model",
+			Created:       now,
+			OwnedBy:       "antigravity",
+			Type:          "antigravity",
+			DisplayName:   "Gemini 3 Pro High",
+			ContextWindow: geminiContextWindow,
+			Name:          "models/gemini-3-pro-high",
+			Thinking:      &ThinkingSupport{Min: 128, Max: 32768, ZeroAllowed: false, DynamicAllowed: true},
 		},
 		{
-			ID:          "gemini-3-pro-low",
-			Object:      "model",
-			Created:     now,
-			OwnedBy:     "antigravity",
-			Type:        "antigravity",
-			DisplayName: "Gemini 3 Pro Low",
-			Name:        "models/gemini-3-pro-low",
-			Thinking:    &ThinkingSupport{Min: 128, Max: 8192, ZeroAllowed: false, DynamicAllowed: true},
+			ID:            "gemini-3-pro-low",
+			Object:        "model",
+			Created:       now,
+			OwnedBy:       "antigravity",
+			Type:          "antigravity",
+			DisplayName:   "Gemini 3 Pro Low",
+			ContextWindow: geminiContextWindow,
+			Name:          "models/gemini-3-pro-low",
+			Thinking:      &ThinkingSupport{Min: 128, Max: 8192, ZeroAllowed: false, DynamicAllowed: true},
 		},
 		{
 			ID:                  "claude-sonnet-4-5",
@@ -143,6 +157,7 @@ func (r *Registry) loadDefaultModels() {
 			OwnedBy:             "antigravity",
 			Type:                "antigravity",
 			DisplayName:         "Claude Sonnet 4.5",
+			ContextWindow:       claudeContextWindow,
 			MaxCompletionTokens: 64000,
 		},
 		{
@@ -152,6 +167,7 @@ func (r *Registry) loadDefaultModels() {
 			OwnedBy:             "antigravity",
 			Type:                "antigravity",
 			DisplayName:         "Claude Sonnet 4.5 (Thinking)",
+			ContextWindow:       claudeContextWindow,
 			MaxCompletionTokens: 64000,
 			Thinking:            &ThinkingSupport{Min: 1024, Max: 200000, ZeroAllowed: false, DynamicAllowed: true},
 		},
@@ -162,6 +178,7 @@ func (r *Registry) loadDefaultModels() {
 			OwnedBy:             "antigravity",
 			Type:                "antigravity",
 			DisplayName:         "Claude Opus 4.5 (Thinking)",
+			ContextWindow:       claudeContextWindow,
 			MaxCompletionTokens: 64000,
 			Thinking:            &ThinkingSupport{Min: 1024, Max: 200000, ZeroAllowed: false, DynamicAllowed: true},
 		},
@@ -172,6 +189,7 @@ func (r *Registry) loadDefaultModels() {
 			OwnedBy:             "antigravity",
 			Type:                "antigravity",
 			DisplayName:         "Claude Opus 4.5",
+			ContextWindow:       claudeContextWindow,
 			MaxCompletionTokens: 64000,
 		},
 	}
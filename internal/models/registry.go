@@ -17,6 +17,7 @@ type ModelInfo struct {
 	Version             string           `json:"version,omitempty"`
 	Description         string           `json:"description,omitempty"`
 	MaxCompletionTokens int              `json:"max_completion_tokens,omitempty"`
+	ContextWindow       int              `json:"context_window,omitempty"`
 	Thinking            *ThinkingSupport `json:"thinking,omitempty"`
 }
 
@@ -59,6 +60,14 @@ func Alias2ModelName(modelName string) string {
 	return modelName
 }
 
+// ContextWindow returns the context window of a model in tokens, or 0 if unknown.
+func ContextWindow(model string) int {
+	if m := GetGlobalRegistry().GetModel(model); m != nil {
+		return m.ContextWindow
+	}
+	return 0
+}
+
 // Registry manages available models.
 type Registry struct {
 	models map[string]*ModelInfo
@@ -114,14 +114,9 @@ func ApplyReasoningEffortToPayload(modelName string, payload []byte, effort stri
 	includePath := "request.generationConfig.thinkingConfig.include_thoughts"
 
 	if normalized == "none" {
-		info := GetModelConfig(modelName)
-		// Only disable thinking if the model explicitly allows zero budget
-		if info != nil && info.Thinking != nil && info.Thinking.ZeroAllowed {
-			payload, _ = sjson.SetBytes(payload, budgetPath, 0)
-			payload, _ = sjson.SetBytes(payload, includePath, false)
-			return payload
-		}
-		// Otherwise, do nothing and let the default injection logic take over
+		// Models that cannot disable thinking get their minimum budget
+		payload, _ = sjson.SetBytes(payload, budgetPath, NormalizeThinkingBudget(modelName, 0))
+		payload, _ = sjson.SetBytes(payload, includePath, false)
 		return payload
 	}
 
@@ -135,8 +130,9 @@ func ApplyReasoningEffortToPayload(modelName string, payload []byte, effort stri
 	return payload
 }
 
-// StripThinkingConfigIfUnsupported removes thinkingConfig when the model doesn't support it
-// or if the budget is set to 0 (explicitly disabled).
+// StripThinkingConfigIfUnsupported removes thinkingConfig when the model doesn't support it.
+// Budgets of 0 (disabled) and -1 (dynamic) are kept for models that allow them; a budget
+// the model cannot take, e.g. 0 after clamping below a small maxOutputTokens, is removed.
 func StripThinkingConfigIfUnsupported(model string, payload []byte) []byte {
 	if len(payload) == 0 {
 		return payload
@@ -149,9 +145,10 @@ func StripThinkingConfigIfUnsupported(model string, payload []byte) []byte {
 		return payload
 	}
 
-	// Remove if budget is explicitly 0 (none)
+	// Remove if the model does not allow the budget
+	t := GetModelConfig(model).Thinking
 	budget := gjson.GetBytes(payload, "request.generationConfig.thinkingConfig.thinkingBudget")
-	if budget.Exists() && budget.Int() <= 0 {
+	if budget.Exists() && ((budget.Int() == 0 && !t.ZeroAllowed) || (budget.Int() < 0 && !t.DynamicAllowed)) {
 		payload, _ = sjson.DeleteBytes(payload, "request.generationConfig.thinkingConfig")
 	}
 
@@ -161,17 +158,29 @@ func StripThinkingConfigIfUnsupported(model string, payload []byte) []byte {
 // DefaultThinkingBudget is the default reasoning budget for thinking models ("high" level).
 const DefaultThinkingBudget = 24576
 
-// ApplyDefaultThinkingIfNeeded injects default thinkingConfig for models that support thinking.
-// Uses "high" reasoning effort (24576 tokens) by default, except for gemini-3-flash which uses "minimal".
-func ApplyDefaultThinkingIfNeeded(model string, payload []byte) []byte {
+// BuiltinThinkingBudget returns the built-in default thinking budget for a model:
+// "high" reasoning effort, except for gemini-3-flash which uses "minimal".
+func BuiltinThinkingBudget(model string) int {
+	if model == "gemini-3-flash" {
+		return ReasoningEffortBudgetMapping["minimal"]
+	}
+	return DefaultThinkingBudget
+}
+
+// ApplyDefaultThinkingIfNeeded completes the thinkingConfig for models that support thinking.
+// A budget set explicitly by the client wins; otherwise defaultBudget is used.
+// Either way the budget is clamped to the model's supported range and kept below maxOutputTokens.
+func ApplyDefaultThinkingIfNeeded(model string, payload []byte, defaultBudget int) []byte {
 	if !ModelHasDefaultThinking(model) {
 		return payload
 	}
 
-	// We enforce default thinking config, ignoring client overrides
-	budget := DefaultThinkingBudget
-	if model == "gemini-3-flash" {
-		budget = ReasoningEffortBudgetMapping["minimal"]
+	budgetPath := "request.generationConfig.thinkingConfig.thinkingBudget"
+	includePath := "request.generationConfig.thinkingConfig.include_thoughts"
+
+	budget := defaultBudget
+	if explicit := gjson.GetBytes(payload, budgetPath); explicit.Exists() {
+		budget = int(explicit.Int())
 	}
 
 	// Clamp the budget to the model's supported range (e.g. gemini-3-flash-minimal max 512)
@@ -179,30 +188,19 @@ func ApplyDefaultThinkingIfNeeded(model string, payload []byte) []byte {
 
 	// Ensure budget is less than maxOutputTokens if set
 	maxTokens := gjson.GetBytes(payload, "request.generationConfig.maxOutputTokens")
-	if maxTokens.Exists() && maxTokens.Int() > 0 {
+	if budget > 0 && maxTokens.Exists() && maxTokens.Int() > 0 {
 		mt := int(maxTokens.Int())
 		if budget >= mt {
-			// Reserve some tokens for response or just cap it below max
-			// Using 80% of max tokens or max tokens - 1024 as heuristic,
-			// but simply ensuring it's strictly less is the hard requirement.
-			// Let's safe-guard it to be at most maxTokens.
-			// However, usually we need room for the actual response.
-			// Let's cap at maxTokens - 1 (strict requirement is budget < max)
-			// A safer bet is likely min(budget, maxTokens) but strictly less.
-			newBudget := mt - 1
-			if newBudget < 0 {
-				newBudget = 0
-			}
-			// If the clamped budget is below the model's minimum, we might have a problem,
-			// but we must respect the max_tokens constraint first to avoid API error.
-			if newBudget < budget {
-				budget = newBudget
-			}
+			// The upstream requires the budget to be strictly less than
+			// maxOutputTokens; this takes precedence over the model minimum.
+			budget = max(mt-1, 0)
 		}
 	}
 
-	payload, _ = sjson.SetBytes(payload, "request.generationConfig.thinkingConfig.thinkingBudget", budget)
-	payload, _ = sjson.SetBytes(payload, "request.generationConfig.thinkingConfig.include_thoughts", true)
+	payload, _ = sjson.SetBytes(payload, budgetPath, budget)
+	if !gjson.GetBytes(payload, includePath).Exists() {
+		payload, _ = sjson.SetBytes(payload, includePath, budget != 0)
+	}
 	return payload
 }
 
@@ -0,0 +1,149 @@
+// Package ratelimit enforces per-key request and token budgets over fixed
+// one-minute windows, backed by local memory or a shared store.
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Window is the length of a rate limit window.
+const Window = time.Minute
+
+// Store holds window counters. Implementations must be safe for concurrent use.
+type Store interface {
+	// Incr adds delta to the counter for key in the current window and returns
+	// the new total along with the time the window resets. A delta of 0 reads
+	// the counter.
+	Incr(ctx context.Context, key string, delta int64, window time.Duration) (int64, time.Time, error)
+}
+
+// Limits are the budgets applied to a key. Zero disables a budget.
+type Limits struct {
+	RPM int // Requests per minute
+	TPM int // Tokens per minute
+}
+
+// Status describes the state of a key's budgets after a check.
+type Status struct {
+	Allowed bool
+
+	RequestLimit     int64
+	RequestRemaining int64
+	RequestReset     time.Time
+
+	TokenLimit     int64
+	TokenRemaining int64
+	TokenReset     time.Time
+}
+
+// Limiter checks and records usage against per-key limits.
+type Limiter struct {
+	store Store
+}
+
+// New creates a limiter backed by store.
+func New(store Store) *Limiter {
+	return &Limiter{store: store}
+}
+
+// Allow counts a request for key and reports whether it fits within limits.
+// The token budget is checked against tokens already recorded in the window.
+func (l *Limiter) Allow(ctx context.Context, key string, limits Limits) (Status, error) {
+	status := Status{Allowed: true}
+
+	if limits.TPM > 0 {
+		used, reset, err := l.store.Incr(ctx, key+":tpm", 0, Window)
+		if err != nil {
+			return status, err
+		}
+		status.TokenLimit = int64(limits.TPM)
+		status.TokenRemaining = max(status.TokenLimit-used, 0)
+		status.TokenReset = reset
+		if used >= status.TokenLimit {
+			status.Allowed = false
+		}
+	}
+
+	if limits.RPM > 0 {
+		// Only count requests that are not already rejected by the token budget
+		delta := int64(1)
+		if !status.Allowed {
+			delta = 0
+		}
+		count, reset, err := l.store.Incr(ctx, key+":rpm", delta, Window)
+		if err != nil {
+			return status, err
+		}
+		status.RequestLimit = int64(limits.RPM)
+		status.RequestRemaining = max(status.RequestLimit-count, 0)
+		status.RequestReset = reset
+		if count > status.RequestLimit {
+			status.Allowed = false
+		}
+	}
+
+	return status, nil
+}
+
+// RecordTokens adds tokens consumed by a completed request to key's token budget.
+func (l *Limiter) RecordTokens(ctx context.Context, key string, tokens int64) error {
+	if tokens <= 0 {
+		return nil
+	}
+	_, _, err := l.store.Incr(ctx, key+":tpm", tokens, Window)
+	return err
+}
+
+// memoryEntry is a counter for one key and window.
+type memoryEntry struct {
+	count int64
+	reset time.Time
+}
+
+// MemoryStore keeps counters in process memory and evicts idle entries.
+type MemoryStore struct {
+	mu        sync.Mutex
+	entries   map[string]*memoryEntry
+	lastSweep time.Time
+}
+
+// NewMemoryStore creates an empty in-memory store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		entries:   make(map[string]*memoryEntry),
+		lastSweep: time.Now(),
+	}
+}
+
+// Incr implements Store.
+func (m *MemoryStore) Incr(_ context.Context, key string, delta int64, window time.Duration) (int64, time.Time, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	m.sweepLocked(now, window)
+
+	entry, ok := m.entries[key]
+	if !ok || !now.Before(entry.reset) {
+		entry = &memoryEntry{reset: now.Truncate(window).Add(window)}
+		m.entries[key] = entry
+	}
+	entry.count += delta
+	return entry.count, entry.reset, nil
+}
+
+// sweepLocked drops entries whose window has ended, at most once per window.
+// Caller must hold the lock.
+func (m *MemoryStore) sweepLocked(now time.Time, window time.Duration) {
+	if now.Sub(m.lastSweep) < window {
+		return
+	}
+	for key, entry := range m.entries {
+		if !now.Before(entry.reset) {
+			delete(m.entries, key)
+		}
+	}
+	m.lastSweep = now
+}
@@ -0,0 +1,235 @@
+package ratelimit
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// redisKeyPrefix namespaces rate limit counters in the shared store.
+const redisKeyPrefix = "antigravity:ratelimit:"
+
+// redisMaxIdle is the number of idle connections kept for reuse.
+const redisMaxIdle = 16
+
+// incrScript adds to a window counter and sets its expiry in one atomic step,
+// so that a counter never outlives its window.
+const incrScript = `local count = redis.call('INCRBY', KEYS[1], ARGV[1])
+if redis.call('PTTL', KEYS[1]) < 0 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return count`
+
+// RedisStore keeps counters in Redis so that multiple replicas share one budget.
+// It speaks the minimal subset of the RESP protocol needed to run incrScript,
+// over a small pool of connections.
+type RedisStore struct {
+	addr     string
+	password string
+	db       int
+	timeout  time.Duration
+
+	mu   sync.Mutex
+	idle []*redisConn
+}
+
+// redisConn is a connection with its buffered reader.
+type redisConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// NewRedisStore creates a store from a URL of the form
+// redis://[:password@]host:port[/db].
+func NewRedisStore(rawURL string) (*RedisStore, error) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("parse redis URL: %w", err)
+	}
+	if parsed.Scheme != "redis" {
+		return nil, fmt.Errorf("unsupported redis URL scheme: %s", parsed.Scheme)
+	}
+
+	store := &RedisStore{
+		addr:    parsed.Host,
+		timeout: 2 * time.Second,
+	}
+	if parsed.Port() == "" {
+		store.addr = net.JoinHostPort(parsed.Hostname(), "6379")
+	}
+	if parsed.User != nil {
+		store.password, _ = parsed.User.Password()
+	}
+	if db := strings.TrimPrefix(parsed.Path, "/"); db != "" {
+		store.db, err = strconv.Atoi(db)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redis database: %s", db)
+		}
+	}
+	return store, nil
+}
+
+// Incr implements Store.
+func (r *RedisStore) Incr(ctx context.Context, key string, delta int64, window time.Duration) (int64, time.Time, error) {
+	now := time.Now()
+	start := now.Truncate(window)
+	reset := start.Add(window)
+	windowKey := redisKeyPrefix + hashKey(key) + ":" + strconv.FormatInt(start.Unix(), 10)
+	ttl := reset.Sub(now) + time.Second
+
+	count, err := r.command(ctx, "EVAL", incrScript, "1", windowKey,
+		strconv.FormatInt(delta, 10), strconv.FormatInt(ttl.Milliseconds(), 10))
+	if err != nil {
+		return 0, reset, err
+	}
+	return count, reset, nil
+}
+
+// hashKey hashes a counter key, which contains API keys, so that they do not
+// appear in Redis.
+func hashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:16])
+}
+
+// command sends a command on a pooled connection and returns its integer
+// reply. A failed pooled connection, which may have gone stale while idle, is
+// retried once on a new connection.
+func (r *RedisStore) command(ctx context.Context, args ...string) (int64, error) {
+	var lastErr error
+	for attempt := 0; attempt < 2; attempt++ {
+		rc, pooled := r.get()
+		if rc == nil {
+			var err error
+			if rc, err = r.connect(ctx); err != nil {
+				return 0, err
+			}
+		}
+
+		n, err := rc.roundTrip(ctx, r.timeout, args)
+		if err == nil {
+			r.put(rc)
+			return n, nil
+		}
+		if _, isReplyErr := err.(redisError); isReplyErr {
+			r.put(rc)
+			return 0, err
+		}
+		_ = rc.conn.Close()
+		if !pooled || ctx.Err() != nil {
+			return 0, err
+		}
+		lastErr = err
+	}
+	return 0, lastErr
+}
+
+// get takes an idle connection from the pool, reporting false if there is none.
+func (r *RedisStore) get() (*redisConn, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.idle) == 0 {
+		return nil, false
+	}
+	rc := r.idle[len(r.idle)-1]
+	r.idle = r.idle[:len(r.idle)-1]
+	return rc, true
+}
+
+// put returns a connection to the pool, closing it if the pool is full.
+func (r *RedisStore) put(rc *redisConn) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.idle) >= redisMaxIdle {
+		_ = rc.conn.Close()
+		return
+	}
+	r.idle = append(r.idle, rc)
+}
+
+// connect dials Redis and authenticates.
+func (r *RedisStore) connect(ctx context.Context) (*redisConn, error) {
+	dialer := net.Dialer{Timeout: r.timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", r.addr)
+	if err != nil {
+		return nil, fmt.Errorf("connect to redis: %w", err)
+	}
+	rc := &redisConn{conn: conn, reader: bufio.NewReader(conn)}
+
+	if r.password != "" {
+		if _, err := rc.roundTrip(ctx, r.timeout, []string{"AUTH", r.password}); err != nil {
+			_ = conn.Close()
+			return nil, fmt.Errorf("redis auth: %w", err)
+		}
+	}
+	if r.db != 0 {
+		if _, err := rc.roundTrip(ctx, r.timeout, []string{"SELECT", strconv.Itoa(r.db)}); err != nil {
+			_ = conn.Close()
+			return nil, fmt.Errorf("redis select: %w", err)
+		}
+	}
+	return rc, nil
+}
+
+// roundTrip writes a command and reads a single reply. Integer replies are
+// returned as-is; simple string replies return 0. It gives up after timeout,
+// at the context's deadline, or when the context is canceled.
+func (rc *redisConn) roundTrip(ctx context.Context, timeout time.Duration, args []string) (n int64, err error) {
+	deadline := time.Now().Add(timeout)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+	_ = rc.conn.SetDeadline(deadline)
+	stop := context.AfterFunc(ctx, func() {
+		_ = rc.conn.SetDeadline(time.Now())
+	})
+	defer func() {
+		// Once the context has fired, the connection's deadline may change
+		// under a later user, so it must not be reused
+		if !stop() {
+			err = fmt.Errorf("redis: %w", ctx.Err())
+		}
+	}()
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err = rc.conn.Write([]byte(b.String())); err != nil {
+		return 0, err
+	}
+
+	line, err := rc.reader.ReadString('\n')
+	if err != nil {
+		return 0, err
+	}
+	line = strings.TrimRight(line, "\r\n")
+	if line == "" {
+		return 0, fmt.Errorf("empty redis reply")
+	}
+
+	switch line[0] {
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '+':
+		return 0, nil
+	case '-':
+		return 0, redisError(line[1:])
+	default:
+		return 0, fmt.Errorf("unexpected redis reply: %q", line)
+	}
+}
+
+// redisError is an error reply from the server.
+type redisError string
+
+func (e redisError) Error() string { return "redis: " + string(e) }
@@ -0,0 +1,120 @@
+package responsecache
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// DiskStore keeps cached values as files in a directory, so that they survive
+// restarts. Entries expire by modification time; the oldest are evicted once
+// the store holds more than maxEntries.
+type DiskStore struct {
+	dir        string
+	ttl        time.Duration
+	maxEntries int
+
+	mu sync.Mutex
+}
+
+// NewDiskStore creates a store in dir, creating the directory if needed.
+func NewDiskStore(dir string, ttl time.Duration, maxEntries int) (*DiskStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &DiskStore{dir: dir, ttl: ttl, maxEntries: maxEntries}, nil
+}
+
+// Get implements Store.
+func (d *DiskStore) Get(key string) ([]byte, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	path := d.path(key)
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, false
+	}
+	if time.Since(info.ModTime()) >= d.ttl {
+		_ = os.Remove(path)
+		return nil, false
+	}
+	value, err := os.ReadFile(path)
+	if err != nil {
+		return nil, false
+	}
+	return value, true
+}
+
+// Set implements Store.
+func (d *DiskStore) Set(key string, value []byte) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	// Write atomically so that concurrent readers never see a partial entry
+	tmp, err := os.CreateTemp(d.dir, ".tmp-*")
+	if err != nil {
+		log.Warnf("Failed to write response cache entry: %v", err)
+		return
+	}
+	_, writeErr := tmp.Write(value)
+	closeErr := tmp.Close()
+	if writeErr != nil || closeErr != nil {
+		_ = os.Remove(tmp.Name())
+		log.Warnf("Failed to write response cache entry: %v", writeErr)
+		return
+	}
+	if err := os.Rename(tmp.Name(), d.path(key)); err != nil {
+		_ = os.Remove(tmp.Name())
+		log.Warnf("Failed to write response cache entry: %v", err)
+		return
+	}
+
+	d.evictLocked()
+}
+
+// evictLocked removes expired entries and, if still over capacity, the least
+// recently written ones. Caller must hold the lock.
+func (d *DiskStore) evictLocked() {
+	entries, err := os.ReadDir(d.dir)
+	if err != nil {
+		return
+	}
+
+	type file struct {
+		path    string
+		modTime time.Time
+	}
+	files := make([]file, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		path := filepath.Join(d.dir, entry.Name())
+		if time.Since(info.ModTime()) >= d.ttl {
+			_ = os.Remove(path)
+			continue
+		}
+		files = append(files, file{path: path, modTime: info.ModTime()})
+	}
+
+	if d.maxEntries <= 0 || len(files) <= d.maxEntries {
+		return
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].modTime.Before(files[j].modTime) })
+	for _, f := range files[:len(files)-d.maxEntries] {
+		_ = os.Remove(f.path)
+	}
+}
+
+func (d *DiskStore) path(key string) string {
+	return filepath.Join(d.dir, key+".json")
+}
@@ -0,0 +1,167 @@
+// Package responsecache caches upstream responses to deterministic requests,
+// keyed on an exact match of the model and normalized request payload.
+package responsecache
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// Store holds cached upstream response bodies. Implementations must be safe
+// for concurrent use.
+type Store interface {
+	Get(key string) ([]byte, bool)
+	Set(key string, value []byte)
+}
+
+// Cacheable reports whether an Antigravity request is deterministic enough to
+// cache, i.e. it explicitly asks for temperature 0.
+func Cacheable(payload []byte) bool {
+	temperature := gjson.GetBytes(payload, "request.generationConfig.temperature")
+	return temperature.Exists() && temperature.Float() == 0
+}
+
+// Key returns the cache key for a request. scope separates the entries of
+// different clients, e.g. API keys. The payload is normalized by sorting object
+// keys and removing insignificant whitespace.
+func Key(scope, model string, payload []byte) string {
+	normalized := gjson.GetBytes(payload, `@pretty:{"sortKeys":true}|@ugly`).Raw
+	sum := sha256.Sum256([]byte(scope + "\n" + model + "\n" + normalized))
+	return hex.EncodeToString(sum[:])
+}
+
+// memoryEntry is a cached value in the LRU list.
+type memoryEntry struct {
+	key     string
+	value   []byte
+	expires time.Time
+}
+
+// MemoryStore is an in-memory LRU cache with a TTL.
+type MemoryStore struct {
+	ttl        time.Duration
+	maxEntries int
+
+	mu      sync.Mutex
+	order   *list.List // most recently used first
+	entries map[string]*list.Element
+}
+
+// NewMemoryStore creates a store holding up to maxEntries values for ttl.
+func NewMemoryStore(ttl time.Duration, maxEntries int) *MemoryStore {
+	return &MemoryStore{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		order:      list.New(),
+		entries:    make(map[string]*list.Element),
+	}
+}
+
+// Get implements Store.
+func (m *MemoryStore) Get(key string) ([]byte, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	elem, ok := m.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := elem.Value.(*memoryEntry)
+	if !time.Now().Before(entry.expires) {
+		m.order.Remove(elem)
+		delete(m.entries, key)
+		return nil, false
+	}
+	m.order.MoveToFront(elem)
+	return entry.value, true
+}
+
+// Set implements Store.
+func (m *MemoryStore) Set(key string, value []byte) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if elem, ok := m.entries[key]; ok {
+		m.order.Remove(elem)
+	}
+	m.entries[key] = m.order.PushFront(&memoryEntry{
+		key:     key,
+		value:   value,
+		expires: time.Now().Add(m.ttl),
+	})
+
+	for m.maxEntries > 0 && m.order.Len() > m.maxEntries {
+		oldest := m.order.Back()
+		m.order.Remove(oldest)
+		delete(m.entries, oldest.Value.(*memoryEntry).key)
+	}
+}
+
+// MergeStream combines the chunks of a streamed Antigravity response into the
+// equivalent non-streaming response, so that it can be cached and replayed in
+// either mode. Consecutive text parts of the same kind are concatenated.
+func MergeStream(chunks [][]byte) []byte {
+	out := `{"response":{"candidates":[{"content":{"role":"model","parts":[]}}]}}`
+	parts := make([]string, 0)
+	var text strings.Builder
+	textThought := false
+	textSignature := ""
+
+	flushText := func() {
+		if text.Len() == 0 && textSignature == "" {
+			return
+		}
+		part := `{}`
+		if textThought {
+			part, _ = sjson.Set(part, "thought", true)
+		}
+		part, _ = sjson.Set(part, "text", text.String())
+		if textSignature != "" {
+			part, _ = sjson.Set(part, "thoughtSignature", textSignature)
+		}
+		parts = append(parts, part)
+		text.Reset()
+		textSignature = ""
+	}
+
+	for _, chunk := range chunks {
+		response := gjson.GetBytes(chunk, "response")
+		for _, field := range []string{"modelVersion", "responseId", "createTime", "usageMetadata"} {
+			if v := response.Get(field); v.Exists() {
+				out, _ = sjson.SetRaw(out, "response."+field, v.Raw)
+			}
+		}
+		if v := response.Get("candidates.0.finishReason"); v.Exists() {
+			out, _ = sjson.SetRaw(out, "response.candidates.0.finishReason", v.Raw)
+		}
+
+		response.Get("candidates.0.content.parts").ForEach(func(_, part gjson.Result) bool {
+			if t := part.Get("text"); t.Exists() {
+				thought := part.Get("thought").Bool()
+				if thought != textThought || textSignature != "" {
+					flushText()
+				}
+				textThought = thought
+				text.WriteString(t.String())
+				textSignature = part.Get("thoughtSignature").String()
+				return true
+			}
+			flushText()
+			parts = append(parts, part.Raw)
+			return true
+		})
+	}
+	flushText()
+
+	for _, part := range parts {
+		out, _ = sjson.SetRaw(out, "response.candidates.0.content.parts.-1", part)
+	}
+	return []byte(out)
+}
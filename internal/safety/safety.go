@@ -0,0 +1,100 @@
+// Package safety resolves the Gemini safety settings sent upstream from the
+// configured policy, per-key overrides and client-provided settings.
+package safety
+
+import (
+	"fmt"
+
+	"github.com/tidwall/gjson"
+)
+
+// Categories are the harm categories the upstream accepts, in the order they
+// are sent.
+var Categories = []string{
+	"HARM_CATEGORY_HARASSMENT",
+	"HARM_CATEGORY_HATE_SPEECH",
+	"HARM_CATEGORY_SEXUALLY_EXPLICIT",
+	"HARM_CATEGORY_DANGEROUS_CONTENT",
+	"HARM_CATEGORY_CIVIC_INTEGRITY",
+}
+
+// defaultThresholds disable blocking for every category.
+var defaultThresholds = map[string]string{
+	"HARM_CATEGORY_HARASSMENT":        "OFF",
+	"HARM_CATEGORY_HATE_SPEECH":       "OFF",
+	"HARM_CATEGORY_SEXUALLY_EXPLICIT": "OFF",
+	"HARM_CATEGORY_DANGEROUS_CONTENT": "OFF",
+	"HARM_CATEGORY_CIVIC_INTEGRITY":   "BLOCK_NONE",
+}
+
+// thresholds are the block thresholds the upstream accepts.
+var thresholds = map[string]bool{
+	"BLOCK_LOW_AND_ABOVE":    true,
+	"BLOCK_MEDIUM_AND_ABOVE": true,
+	"BLOCK_ONLY_HIGH":        true,
+	"BLOCK_NONE":             true,
+	"OFF":                    true,
+}
+
+// Policy selects the safety thresholds applied to requests.
+type Policy struct {
+	// Thresholds maps harm categories to block thresholds. Categories that are
+	// not listed are not blocked.
+	Thresholds map[string]string `yaml:"thresholds" json:"thresholds,omitempty"`
+
+	// AllowClientSettings lets clients override thresholds with Gemini-style
+	// safety_settings in the request body.
+	AllowClientSettings bool `yaml:"allow_client_settings" json:"allow_client_settings,omitempty"`
+}
+
+// Validate checks that the policy only uses known categories and thresholds.
+func (p Policy) Validate() error {
+	for category, threshold := range p.Thresholds {
+		if err := validate(category, threshold); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Settings returns the safety settings for a request. clientSettings is the
+// request's safety_settings field; it is ignored unless the policy allows it.
+func (p Policy) Settings(clientSettings gjson.Result) ([]map[string]string, error) {
+	effective := make(map[string]string, len(Categories))
+	for category, threshold := range defaultThresholds {
+		effective[category] = threshold
+	}
+	for category, threshold := range p.Thresholds {
+		effective[category] = threshold
+	}
+
+	if p.AllowClientSettings && clientSettings.Exists() {
+		if !clientSettings.IsArray() {
+			return nil, fmt.Errorf("safety_settings must be an array")
+		}
+		for _, setting := range clientSettings.Array() {
+			category := setting.Get("category").String()
+			threshold := setting.Get("threshold").String()
+			if err := validate(category, threshold); err != nil {
+				return nil, err
+			}
+			effective[category] = threshold
+		}
+	}
+
+	settings := make([]map[string]string, 0, len(Categories))
+	for _, category := range Categories {
+		settings = append(settings, map[string]string{"category": category, "threshold": effective[category]})
+	}
+	return settings, nil
+}
+
+func validate(category, threshold string) error {
+	if _, ok := defaultThresholds[category]; !ok {
+		return fmt.Errorf("unknown safety category: %q", category)
+	}
+	if !thresholds[threshold] {
+		return fmt.Errorf("unknown safety threshold for %s: %q", category, threshold)
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+// Package thoughtsig wraps upstream thought signatures in opaque envelopes that
+// are handed to clients and verified when they are sent back.
+//
+// An envelope records the upstream model that produced the signature and is
+// authenticated with HMAC-SHA256, so clients cannot forge signatures and
+// signatures from another model family can be dropped instead of being
+// rejected upstream.
+package thoughtsig
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"strings"
+)
+
+// version prefixes the envelope payload so that the format can evolve.
+const version = "v1"
+
+// Signer wraps and verifies thought signatures. A nil Signer passes
+// signatures through unchanged.
+type Signer struct {
+	key []byte
+}
+
+// New creates a signer keyed by secret. An empty secret generates a random
+// key, so envelopes only verify within the current process.
+func New(secret string) *Signer {
+	key := []byte(secret)
+	if len(key) == 0 {
+		key = make([]byte, 32)
+		_, _ = rand.Read(key)
+	}
+	return &Signer{key: key}
+}
+
+// Family returns the model family whose thought signatures are interchangeable.
+func Family(model string) string {
+	if strings.Contains(strings.ToLower(model), "claude") {
+		return "claude"
+	}
+	return "gemini"
+}
+
+// Wrap returns an envelope for a signature produced by model.
+func (s *Signer) Wrap(model, signature string) string {
+	if s == nil || signature == "" {
+		return signature
+	}
+
+	var payload bytes.Buffer
+	payload.WriteString(version)
+	payload.WriteByte(0)
+	payload.WriteString(model)
+	payload.WriteByte(0)
+	payload.WriteString(signature)
+	payload.Write(s.mac(payload.Bytes()))
+	return base64.RawURLEncoding.EncodeToString(payload.Bytes())
+}
+
+// Unwrap verifies an envelope and returns the signature it holds. It reports
+// false for envelopes that are malformed, were not issued by this signer, or
+// were produced by a model outside the family of model.
+func (s *Signer) Unwrap(model, envelope string) (string, bool) {
+	if s == nil {
+		return envelope, envelope != ""
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(envelope)
+	if err != nil || len(raw) < sha256.Size {
+		return "", false
+	}
+	payload, sum := raw[:len(raw)-sha256.Size], raw[len(raw)-sha256.Size:]
+	if !hmac.Equal(sum, s.mac(payload)) {
+		return "", false
+	}
+
+	fields := bytes.SplitN(payload, []byte{0}, 3)
+	if len(fields) != 3 || string(fields[0]) != version || len(fields[2]) == 0 {
+		return "", false
+	}
+	if Family(string(fields[1])) != Family(model) {
+		return "", false
+	}
+	return string(fields[2]), true
+}
+
+func (s *Signer) mac(payload []byte) []byte {
+	h := hmac.New(sha256.New, s.key)
+	h.Write(payload)
+	return h.Sum(nil)
+}
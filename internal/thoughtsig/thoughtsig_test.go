@@ -0,0 +1,97 @@
+package thoughtsig
+
+import (
+	"encoding/base64"
+	"testing"
+)
+
+func TestUnwrap(t *testing.T) {
+	signer := New("secret")
+	gemini := signer.Wrap("gemini-3-pro-high", "sig-gemini")
+	claude := signer.Wrap("claude-sonnet-4-5-thinking", "sig-claude")
+
+	// Flip the last byte of the MAC
+	raw, _ := base64.RawURLEncoding.DecodeString(gemini)
+	raw[len(raw)-1] ^= 0xff
+	tampered := base64.RawURLEncoding.EncodeToString(raw)
+
+	tests := []struct {
+		name     string
+		signer   *Signer
+		model    string
+		envelope string
+		want     string
+		ok       bool
+	}{
+		{"same model", signer, "gemini-3-pro-high", gemini, "sig-gemini", true},
+		{"same family", signer, "gemini-3-flash", gemini, "sig-gemini", true},
+		{"claude family", signer, "claude-opus-4-5-thinking", claude, "sig-claude", true},
+		{"gemini signature for claude", signer, "claude-sonnet-4-5-thinking", gemini, "", false},
+		{"claude signature for gemini", signer, "gemini-3-pro-high", claude, "", false},
+		{"other secret", New("other"), "gemini-3-pro-high", gemini, "", false},
+		{"tampered MAC", signer, "gemini-3-pro-high", tampered, "", false},
+		{"raw upstream signature", signer, "gemini-3-pro-high", "sig-gemini", "", false},
+		{"not base64", signer, "gemini-3-pro-high", "!!!", "", false},
+		{"empty", signer, "gemini-3-pro-high", "", "", false},
+		{"nil signer passes through", nil, "gemini-3-pro-high", "sig-raw", "sig-raw", true},
+		{"nil signer rejects empty", nil, "gemini-3-pro-high", "", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := tt.signer.Unwrap(tt.model, tt.envelope)
+			if got != tt.want || ok != tt.ok {
+				t.Errorf("Unwrap() = %q, %v; want %q, %v", got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestUnwrapForgedModel(t *testing.T) {
+	signer := New("secret")
+
+	// Re-encoding a valid envelope with another model invalidates the MAC
+	raw, _ := base64.RawURLEncoding.DecodeString(signer.Wrap("gemini-3-pro-high", "sig"))
+	forged := append([]byte("v1\x00claude-sonnet-4-5-thinking"), raw[len("v1\x00gemini-3-pro-high"):]...)
+	envelope := base64.RawURLEncoding.EncodeToString(forged)
+
+	if got, ok := signer.Unwrap("claude-sonnet-4-5-thinking", envelope); ok {
+		t.Errorf("Unwrap() of forged envelope = %q, true; want rejection", got)
+	}
+}
+
+func TestWrap(t *testing.T) {
+	tests := []struct {
+		name      string
+		signer    *Signer
+		signature string
+		want      string
+	}{
+		{"nil signer", nil, "sig", "sig"},
+		{"empty signature", New("secret"), "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.signer.Wrap("gemini-3-pro-high", tt.signature); got != tt.want {
+				t.Errorf("Wrap() = %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFamily(t *testing.T) {
+	tests := []struct {
+		model string
+		want  string
+	}{
+		{"claude-sonnet-4-5-thinking", "claude"},
+		{"Claude-Opus-4-5", "claude"},
+		{"gemini-3-pro-high", "gemini"},
+		{"gemini-2.5-flash", "gemini"},
+		{"", "gemini"},
+	}
+	for _, tt := range tests {
+		if got := Family(tt.model); got != tt.want {
+			t.Errorf("Family(%q) = %q; want %q", tt.model, got, tt.want)
+		}
+	}
+}
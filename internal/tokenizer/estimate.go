@@ -0,0 +1,124 @@
+// Package tokenizer estimates token counts locally, for use when the upstream
+// countTokens method is unavailable and for pre-flight context checks.
+package tokenizer
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/tidwall/gjson"
+)
+
+// Per-message overheads, following OpenAI's chat token counting: every message
+// costs a few framing tokens and every reply is primed with a few more.
+const (
+	tokensPerMessage = 3
+	tokensPerReply   = 3
+
+	// imageTokens is the fixed cost Gemini charges for an image part.
+	imageTokens = 258
+)
+
+// EstimateText estimates the number of tokens in s. ASCII text averages about
+// four characters per token; CJK and other non-Latin characters are closer to
+// one token each.
+func EstimateText(s string) int {
+	if s == "" {
+		return 0
+	}
+
+	ascii, other := 0, 0
+	for _, r := range s {
+		switch {
+		case r < utf8.RuneSelf:
+			ascii++
+		case unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul):
+			other += 2
+		default:
+			other++
+		}
+	}
+	return (ascii+3)/4 + (other+1)/2
+}
+
+// EstimateRequest estimates the input tokens of an Antigravity request, i.e. the
+// system instruction, contents and tool declarations under "request".
+func EstimateRequest(payload []byte) int {
+	request := gjson.GetBytes(payload, "request")
+	if !request.Exists() {
+		request = gjson.ParseBytes(payload)
+	}
+
+	total := 0
+	if system := request.Get("systemInstruction"); system.Exists() {
+		total += EstimateContent(system)
+	}
+	request.Get("contents").ForEach(func(_, content gjson.Result) bool {
+		total += EstimateContent(content)
+		return true
+	})
+	total += EstimateTools(request.Get("tools"))
+
+	if total > 0 {
+		total += tokensPerReply
+	}
+	return total
+}
+
+// EstimateContent estimates the tokens in one Gemini content (message),
+// including its framing overhead.
+func EstimateContent(content gjson.Result) int {
+	return tokensPerMessage + EstimateParts(content.Get("parts"))
+}
+
+// EstimateParts estimates the tokens in an array of Gemini content parts.
+func EstimateParts(parts gjson.Result) int {
+	total := 0
+	parts.ForEach(func(_, part gjson.Result) bool {
+		total += estimatePart(part)
+		return true
+	})
+	return total
+}
+
+// EstimateTools estimates the tokens used by tool declarations.
+func EstimateTools(tools gjson.Result) int {
+	if !tools.Exists() {
+		return 0
+	}
+	return EstimateText(tools.Raw)
+}
+
+func estimatePart(part gjson.Result) int {
+	switch {
+	case part.Get("text").Exists():
+		return EstimateText(part.Get("text").String())
+	case part.Get("functionCall").Exists():
+		call := part.Get("functionCall")
+		return EstimateText(call.Get("name").String()) + EstimateText(call.Get("args").Raw)
+	case part.Get("functionResponse").Exists():
+		resp := part.Get("functionResponse")
+		return EstimateText(resp.Get("name").String()) + EstimateText(resp.Get("response").Raw) + EstimateParts(resp.Get("parts"))
+	case part.Get("inlineData").Exists():
+		return estimateInlineData(part.Get("inlineData"))
+	case part.Get("fileData").Exists():
+		return imageTokens
+	default:
+		return 0
+	}
+}
+
+// estimateInlineData charges images a fixed cost and other media by size.
+func estimateInlineData(data gjson.Result) int {
+	mimeType := data.Get("mime_type").String()
+	if mimeType == "" {
+		mimeType = data.Get("mimeType").String()
+	}
+	if strings.HasPrefix(mimeType, "image/") {
+		return imageTokens
+	}
+	// Base64 expands by 4/3; assume about four bytes per token of decoded data
+	decoded := len(data.Get("data").String()) * 3 / 4
+	return max(decoded/4, imageTokens)
+}
@@ -2,9 +2,9 @@ package translator
 
 import (
 	"bytes"
-	"strings"
 
 	"github.com/anthropics/antigravity-wrapper/internal/models"
+	"github.com/anthropics/antigravity-wrapper/internal/thoughtsig"
 	"github.com/tidwall/gjson"
 	"github.com/tidwall/sjson"
 )
@@ -12,12 +12,18 @@ import (
 const geminiCLIClaudeThoughtSignature = "skip_thought_signature_validator"
 
 // ConvertClaudeRequestToAntigravity converts a Claude/Anthropic API request
-// into an Antigravity/Gemini CLI request JSON.
-func ConvertClaudeRequestToAntigravity(modelName string, inputRawJSON []byte, stream bool) []byte {
+// into an Antigravity/Gemini CLI request JSON. Thought signatures in thinking
+// and redacted_thinking blocks are unwrapped with opts.Signatures.
+func ConvertClaudeRequestToAntigravity(modelName string, inputRawJSON []byte, stream bool, opts *TranslatorOptions) []byte {
 	rawJSON := bytes.Clone(inputRawJSON)
 	rawJSON = bytes.Replace(rawJSON, []byte(`"url":{"type":"string","format":"uri",`), []byte(`"url":{"type":"string",`), -1)
 	_ = stream
 
+	if opts == nil {
+		opts = &TranslatorOptions{}
+	}
+	upstreamModel := models.Alias2ModelName(modelName)
+
 	// system instruction
 	systemInstructionJSON := ""
 	hasSystemInstruction := false
@@ -46,6 +52,18 @@ func ConvertClaudeRequestToAntigravity(modelName string, inputRawJSON []byte, st
 	messagesResult := gjson.GetBytes(rawJSON, "messages")
 	if messagesResult.IsArray() {
 		messageResults := messagesResult.Array()
+
+		// Map tool_use IDs to function names so that tool results can name
+		// the function they answer.
+		toolNames := map[string]string{}
+		for _, messageResult := range messageResults {
+			for _, contentResult := range messageResult.Get("content").Array() {
+				if contentResult.Get("type").String() == "tool_use" {
+					toolNames[contentResult.Get("id").String()] = contentResult.Get("name").String()
+				}
+			}
+		}
+
 		for i := 0; i < len(messageResults); i++ {
 			messageResult := messageResults[i]
 			roleResult := messageResult.Get("role")
@@ -61,24 +79,38 @@ func ConvertClaudeRequestToAntigravity(modelName string, inputRawJSON []byte, st
 			contentsResult := messageResult.Get("content")
 			if contentsResult.IsArray() {
 				contentResults := contentsResult.Array()
+				pendingSignature := ""
 				for j := 0; j < len(contentResults); j++ {
 					contentResult := contentResults[j]
 					contentTypeResult := contentResult.Get("type")
-					if contentTypeResult.Type == gjson.String && contentTypeResult.String() == "thinking" {
+					if contentTypeResult.Type == gjson.String && (contentTypeResult.String() == "thinking" || contentTypeResult.String() == "redacted_thinking") {
+						// Only signatures issued by this server for the same model
+						// family are sent back; anything else is dropped
+						envelope := contentResult.Get("signature").String()
+						if contentTypeResult.String() == "redacted_thinking" {
+							envelope = contentResult.Get("data").String()
+						}
+						signature, ok := opts.Signatures.Unwrap(upstreamModel, envelope)
 						prompt := contentResult.Get("thinking").String()
-						signatureResult := contentResult.Get("signature")
-						signature := geminiCLIClaudeThoughtSignature
-						if signatureResult.Exists() {
-							signature = signatureResult.String()
+						if !ok {
+							// The signature cannot be restored, e.g. it was issued under
+							// another secret or by another model family. Gemini accepts
+							// the thoughts with the validator skipped; Claude rejects
+							// unsigned thoughts, so the block is dropped
+							if thoughtsig.Family(modelName) == "claude" {
+								continue
+							}
+							signature = geminiCLIClaudeThoughtSignature
+						}
+						if prompt == "" {
+							// A signature without thinking text belongs to the part that follows it
+							pendingSignature = signature
+							continue
 						}
 						partJSON := `{}`
 						partJSON, _ = sjson.Set(partJSON, "thought", true)
-						if prompt != "" {
-							partJSON, _ = sjson.Set(partJSON, "text", prompt)
-						}
-						if signature != "" {
-							partJSON, _ = sjson.Set(partJSON, "thoughtSignature", signature)
-						}
+						partJSON, _ = sjson.Set(partJSON, "text", prompt)
+						partJSON, _ = sjson.Set(partJSON, "thoughtSignature", signature)
 						clientContentJSON, _ = sjson.SetRaw(clientContentJSON, "parts.-1", partJSON)
 					} else if contentTypeResult.Type == gjson.String && contentTypeResult.String() == "text" {
 						prompt := contentResult.Get("text").String()
@@ -86,6 +118,10 @@ func ConvertClaudeRequestToAntigravity(modelName string, inputRawJSON []byte, st
 						if prompt != "" {
 							partJSON, _ = sjson.Set(partJSON, "text", prompt)
 						}
+						if pendingSignature != "" {
+							partJSON, _ = sjson.Set(partJSON, "thoughtSignature", pendingSignature)
+							pendingSignature = ""
+						}
 						clientContentJSON, _ = sjson.SetRaw(clientContentJSON, "parts.-1", partJSON)
 					} else if contentTypeResult.Type == gjson.String && contentTypeResult.String() == "tool_use" {
 						functionName := contentResult.Get("name").String()
@@ -95,13 +131,16 @@ func ConvertClaudeRequestToAntigravity(modelName string, inputRawJSON []byte, st
 							argsResult := gjson.Parse(functionArgs)
 							if argsResult.IsObject() {
 								partJSON := `{}`
-								if !strings.Contains(modelName, "claude") {
+								if pendingSignature != "" {
+									partJSON, _ = sjson.Set(partJSON, "thoughtSignature", pendingSignature)
+									pendingSignature = ""
+								} else if thoughtsig.Family(modelName) != "claude" {
 									partJSON, _ = sjson.Set(partJSON, "thoughtSignature", geminiCLIClaudeThoughtSignature)
 								}
 								if functionID != "" {
-									partJSON, _ = sjson.Set(partJSON, "functionCall.id", functionID)
+									partJSON, _ = sjson.Set(partJSON, "functionCall.id", upstreamToolCallID(functionID))
 								}
-								partJSON, _ = sjson.Set(partJSON, "functionCall.name", functionName)
+								partJSON, _ = sjson.Set(partJSON, "functionCall.name", sanitizeToolName(functionName))
 								partJSON, _ = sjson.SetRaw(partJSON, "functionCall.args", argsResult.Raw)
 								clientContentJSON, _ = sjson.SetRaw(clientContentJSON, "parts.-1", partJSON)
 							}
@@ -109,52 +148,28 @@ func ConvertClaudeRequestToAntigravity(modelName string, inputRawJSON []byte, st
 					} else if contentTypeResult.Type == gjson.String && contentTypeResult.String() == "tool_result" {
 						toolCallID := contentResult.Get("tool_use_id").String()
 						if toolCallID != "" {
-							funcName := toolCallID
-							toolCallIDs := strings.Split(toolCallID, "-")
-							if len(toolCallIDs) > 1 {
-								funcName = strings.Join(toolCallIDs[0:len(toolCallIDs)-2], "-")
+							funcName, ok := toolNames[toolCallID]
+							if !ok {
+								funcName = toolCallID
 							}
-							functionResponseResult := contentResult.Get("content")
-
-							functionResponseJSON := `{}`
-							functionResponseJSON, _ = sjson.Set(functionResponseJSON, "id", toolCallID)
-							functionResponseJSON, _ = sjson.Set(functionResponseJSON, "name", funcName)
-
-							if functionResponseResult.Type == gjson.String {
-								functionResponseJSON, _ = sjson.Set(functionResponseJSON, "response.result", functionResponseResult.String())
-							} else if functionResponseResult.IsArray() {
-								frResults := functionResponseResult.Array()
-								if len(frResults) == 1 {
-									functionResponseJSON, _ = sjson.SetRaw(functionResponseJSON, "response.result", frResults[0].Raw)
-								} else {
-									functionResponseJSON, _ = sjson.SetRaw(functionResponseJSON, "response.result", functionResponseResult.Raw)
-								}
-							} else if functionResponseResult.IsObject() {
-								functionResponseJSON, _ = sjson.SetRaw(functionResponseJSON, "response.result", functionResponseResult.Raw)
-							} else {
-								functionResponseJSON, _ = sjson.SetRaw(functionResponseJSON, "response.result", functionResponseResult.Raw)
-							}
-
-							partJSON := `{}`
-							partJSON, _ = sjson.SetRaw(partJSON, "functionResponse", functionResponseJSON)
+							partJSON := functionResponsePart(upstreamToolCallID(toolCallID), sanitizeToolName(funcName), contentResult.Get("content"), contentResult.Get("is_error").Bool())
+							clientContentJSON, _ = sjson.SetRaw(clientContentJSON, "parts.-1", partJSON)
+						}
+					} else if contentTypeResult.Type == gjson.String && contentTypeResult.String() == "document" {
+						for _, partJSON := range documentParts(contentResult) {
 							clientContentJSON, _ = sjson.SetRaw(clientContentJSON, "parts.-1", partJSON)
 						}
 					} else if contentTypeResult.Type == gjson.String && contentTypeResult.String() == "image" {
-						sourceResult := contentResult.Get("source")
-						if sourceResult.Get("type").String() == "base64" {
-							inlineDataJSON := `{}`
-							if mimeType := sourceResult.Get("media_type").String(); mimeType != "" {
-								inlineDataJSON, _ = sjson.Set(inlineDataJSON, "mime_type", mimeType)
-							}
-							if data := sourceResult.Get("data").String(); data != "" {
-								inlineDataJSON, _ = sjson.Set(inlineDataJSON, "data", data)
-							}
-							partJSON := `{}`
-							partJSON, _ = sjson.SetRaw(partJSON, "inlineData", inlineDataJSON)
+						if partJSON, ok := imagePart(contentResult); ok {
 							clientContentJSON, _ = sjson.SetRaw(clientContentJSON, "parts.-1", partJSON)
 						}
 					}
 				}
+				if pendingSignature != "" {
+					partJSON := `{"thought":true}`
+					partJSON, _ = sjson.Set(partJSON, "thoughtSignature", pendingSignature)
+					clientContentJSON, _ = sjson.SetRaw(clientContentJSON, "parts.-1", partJSON)
+				}
 				contentsJSON, _ = sjson.SetRaw(contentsJSON, "-1", clientContentJSON)
 				hasContents = true
 			} else if contentsResult.Type == gjson.String {
@@ -186,6 +201,8 @@ func ConvertClaudeRequestToAntigravity(modelName string, inputRawJSON []byte, st
 				tool, _ = sjson.SetRaw(tool, "parametersJsonSchema", inputSchema)
 				tool, _ = sjson.Delete(tool, "strict")
 				tool, _ = sjson.Delete(tool, "input_examples")
+				tool, _ = sjson.Delete(tool, "cache_control")
+				tool, _ = sjson.Set(tool, "name", sanitizeToolName(toolResult.Get("name").String()))
 				toolsJSON, _ = sjson.SetRaw(toolsJSON, "0.functionDeclarations.-1", tool)
 				toolDeclCount++
 			}
@@ -207,12 +224,15 @@ func ConvertClaudeRequestToAntigravity(modelName string, inputRawJSON []byte, st
 
 	// Map Anthropic thinking -> Gemini thinkingBudget/include_thoughts
 	if t := gjson.GetBytes(rawJSON, "thinking"); t.Exists() && t.IsObject() && models.ModelSupportsThinking(modelName) {
-		if t.Get("type").String() == "enabled" {
+		switch t.Get("type").String() {
+		case "enabled":
 			if b := t.Get("budget_tokens"); b.Exists() && b.Type == gjson.Number {
 				budget := int(b.Int())
 				out, _ = sjson.Set(out, "request.generationConfig.thinkingConfig.thinkingBudget", budget)
 				out, _ = sjson.Set(out, "request.generationConfig.thinkingConfig.include_thoughts", true)
 			}
+		case "disabled":
+			out = string(models.ApplyReasoningEffortToPayload(modelName, []byte(out), "none"))
 		}
 	}
 
@@ -229,9 +249,9 @@ func ConvertClaudeRequestToAntigravity(modelName string, inputRawJSON []byte, st
 	if v := gjson.GetBytes(rawJSON, "max_tokens"); v.Exists() && v.Type == gjson.Number {
 		out, _ = sjson.Set(out, "request.generationConfig.maxOutputTokens", v.Num)
 	}
+	if v := gjson.GetBytes(rawJSON, "stop_sequences"); v.IsArray() && len(v.Array()) > 0 {
+		out, _ = sjson.SetRaw(out, "request.generationConfig.stopSequences", v.Raw)
+	}
 
-	outBytes := []byte(out)
-	outBytes = AttachDefaultSafetySettings(outBytes, "request.safetySettings")
-
-	return outBytes
+	return []byte(out)
 }
\ No newline at end of file
@@ -5,9 +5,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"strings"
-	"sync/atomic"
-	"time"
 
+	"github.com/anthropics/antigravity-wrapper/internal/models"
+	"github.com/google/uuid"
 	"github.com/tidwall/gjson"
 	"github.com/tidwall/sjson"
 )
@@ -15,53 +15,150 @@ import (
 // ClaudeStreamState holds state for Claude streaming response conversion.
 type ClaudeStreamState struct {
 	HasFirstResponse     bool
-	ResponseType         int // 0=none, 1=content, 2=thinking, 3=function
+	MessageID            string
+	InputTokens          int64 // input_tokens reported in message_start when the first chunk has no usage
+	ResponseType         int   // 0=none, 1=content, 2=thinking, 3=function, 4=redacted thinking
 	ResponseIndex        int
 	HasFinishReason      bool
 	FinishReason         string
 	HasUsageMetadata     bool
 	PromptTokenCount     int64
+	CachedTokenCount     int64
 	CandidatesTokenCount int64
 	ThoughtsTokenCount   int64
 	TotalTokenCount      int64
 	HasSentFinalEvents   bool
 	HasToolUse           bool
+	ToolUseCount         int // Number of tool_use blocks emitted, used to derive their IDs
 	HasContent           bool
+	Refused              bool            // The prompt or response was blocked by a content filter
+	SafetyRatings        string          // Raw safety ratings of a blocked prompt or response
+	Text                 string          // Response text so far, kept while citations can map to documents
+	Citations            map[string]bool // Citations already emitted
 }
 
-var claudeToolUseIDCounter uint64
+// NewClaudeMessageID returns a unique Anthropic-style message ID.
+func NewClaudeMessageID() string {
+	return "msg_" + strings.ReplaceAll(uuid.NewString(), "-", "")
+}
+
+// appendClaudeEvent appends one server-sent event in the Anthropic wire format.
+func appendClaudeEvent(output *string, event, data string) {
+	*output = *output + "event: " + event + "\ndata: " + data + "\n\n"
+}
+
+// ClaudePing returns a ping event, preceded by message_start if the stream has
+// not started yet, so that it can be sent while the upstream is silent.
+func ClaudePing(modelName string, state *ClaudeStreamState) string {
+	output := ""
+	if !state.HasFirstResponse {
+		// message_start is followed by a ping already
+		appendClaudeMessageStart(modelName, nil, state, &output)
+		return output
+	}
+	appendClaudeEvent(&output, "ping", `{"type":"ping"}`)
+	return output
+}
+
+// ClaudeStreamError returns an error event for a stream that failed after it
+// started.
+func ClaudeStreamError(message string) string {
+	data, _ := sjson.Set(`{"type":"error","error":{"type":"api_error","message":""}}`, "error.message", message)
+	output := ""
+	appendClaudeEvent(&output, "error", data)
+	return output
+}
+
+// appendClaudeMessageStart emits message_start followed by a ping, once per stream.
+func appendClaudeMessageStart(modelName string, rawJSON []byte, state *ClaudeStreamState, output *string) {
+	if state.HasFirstResponse {
+		return
+	}
+	if state.MessageID == "" {
+		state.MessageID = NewClaudeMessageID()
+	}
+
+	inputTokens := state.InputTokens
+	if promptTokens := gjson.GetBytes(rawJSON, "response.usageMetadata.promptTokenCount"); promptTokens.Exists() {
+		inputTokens = promptTokens.Int()
+	}
+
+	messageStart := `{"type":"message_start","message":{"id":"","type":"message","role":"assistant","model":"","content":[],"stop_reason":null,"stop_sequence":null,"usage":{"input_tokens":0,"cache_creation_input_tokens":0,"cache_read_input_tokens":0,"output_tokens":0}}}`
+	messageStart, _ = sjson.Set(messageStart, "message.id", state.MessageID)
+	messageStart, _ = sjson.Set(messageStart, "message.model", modelName)
+	messageStart, _ = sjson.Set(messageStart, "message.usage.input_tokens", inputTokens)
+	appendClaudeEvent(output, "message_start", messageStart)
+	appendClaudeEvent(output, "ping", `{"type":"ping"}`)
+	state.HasFirstResponse = true
+}
+
+// appendClaudeBlockStop closes the open content block, if any.
+func appendClaudeBlockStop(state *ClaudeStreamState, output *string) {
+	if state.ResponseType == 0 {
+		return
+	}
+	appendClaudeEvent(output, "content_block_stop", fmt.Sprintf(`{"type":"content_block_stop","index":%d}`, state.ResponseIndex))
+	state.ResponseIndex++
+	state.ResponseType = 0
+}
+
+// appendClaudeBlockStart closes the open content block and starts a new one.
+func appendClaudeBlockStart(state *ClaudeStreamState, output *string, responseType int, contentBlock string) {
+	appendClaudeBlockStop(state, output)
+	data, _ := sjson.SetRaw(fmt.Sprintf(`{"type":"content_block_start","index":%d}`, state.ResponseIndex), "content_block", contentBlock)
+	appendClaudeEvent(output, "content_block_start", data)
+	state.ResponseType = responseType
+	state.HasContent = true
+}
+
+// appendClaudeDelta emits a content_block_delta for the open block.
+func appendClaudeDelta(state *ClaudeStreamState, output *string, deltaType, field, value string) {
+	data := fmt.Sprintf(`{"type":"content_block_delta","index":%d,"delta":{"type":"%s"}}`, state.ResponseIndex, deltaType)
+	data, _ = sjson.Set(data, "delta."+field, value)
+	appendClaudeEvent(output, "content_block_delta", data)
+}
+
+// appendClaudeSignature attaches a wrapped thought signature to the open
+// thinking block.
+func appendClaudeSignature(modelName string, state *ClaudeStreamState, output *string, signature string, opts *TranslatorOptions) {
+	if state.ResponseType != 2 {
+		appendClaudeRedactedThinking(modelName, state, output, signature, opts)
+		return
+	}
+	envelope := opts.Signatures.Wrap(models.Alias2ModelName(modelName), signature)
+	appendClaudeDelta(state, output, "signature_delta", "signature", envelope)
+}
+
+// appendClaudeRedactedThinking emits a signature attached to a text or tool
+// call part as a redacted_thinking block, so that clients send it back ahead
+// of the part it belongs to.
+func appendClaudeRedactedThinking(modelName string, state *ClaudeStreamState, output *string, signature string, opts *TranslatorOptions) {
+	block, _ := sjson.Set(`{"type":"redacted_thinking","data":""}`, "data", opts.Signatures.Wrap(models.Alias2ModelName(modelName), signature))
+	appendClaudeBlockStart(state, output, 4, block)
+}
 
 // ConvertAntigravityResponseToClaude converts streaming Antigravity responses to Claude SSE format.
-func ConvertAntigravityResponseToClaude(modelName string, rawJSON []byte, state *ClaudeStreamState) []string {
+func ConvertAntigravityResponseToClaude(modelName string, rawJSON []byte, state *ClaudeStreamState, opts *TranslatorOptions) []string {
 	if state == nil {
 		state = &ClaudeStreamState{}
 	}
 
+	if opts == nil {
+		opts = &TranslatorOptions{}
+	}
+
 	if bytes.Equal(rawJSON, []byte("[DONE]")) {
 		output := ""
-		if state.HasContent {
-			appendClaudeFinalEvents(state, &output, true)
-			return []string{output + "event: message_stop\ndata: {\"type\":\"message_stop\"}\n\n\n"}
-		}
-		return []string{}
+		appendClaudeMessageStart(modelName, nil, state, &output)
+		appendClaudeFinalEvents(state, &output, true, opts)
+		appendClaudeEvent(&output, "message_stop", `{"type":"message_stop"}`)
+		return []string{output}
 	}
 
 	output := ""
 
 	// Initialize streaming session with message_start
-	if !state.HasFirstResponse {
-		output = "event: message_start\n"
-		messageStartTemplate := `{"type": "message_start", "message": {"id": "msg_1nZdL29xx5MUA1yADyHTEsnR8uuvGzszyY", "type": "message", "role": "assistant", "content": [], "model": "claude-3-5-sonnet-20241022", "stop_reason": null, "stop_sequence": null, "usage": {"input_tokens": 0, "output_tokens": 0}}}`
-
-		if modelVersionResult := gjson.GetBytes(rawJSON, "response.modelVersion"); modelVersionResult.Exists() {
-			messageStartTemplate, _ = sjson.Set(messageStartTemplate, "message.model", modelVersionResult.String())
-		}
-		if responseIDResult := gjson.GetBytes(rawJSON, "response.responseId"); responseIDResult.Exists() {
-			messageStartTemplate, _ = sjson.Set(messageStartTemplate, "message.id", responseIDResult.String())
-		}
-		output = output + fmt.Sprintf("data: %s\n\n\n", messageStartTemplate)
-		state.HasFirstResponse = true
-	}
+	appendClaudeMessageStart(modelName, rawJSON, state, &output)
 
 	// Process response parts
 	partsResult := gjson.GetBytes(rawJSON, "response.candidates.0.content.parts")
@@ -71,108 +168,92 @@ func ConvertAntigravityResponseToClaude(modelName string, rawJSON []byte, state
 			partResult := partResults[i]
 			partTextResult := partResult.Get("text")
 			functionCallResult := partResult.Get("functionCall")
+			signature := partResult.Get("thoughtSignature").String()
 
-			if partTextResult.Exists() {
+			if partTextResult.Exists() && partResult.Get("thought").Bool() {
 				// Handle thinking content
-				if partResult.Get("thought").Bool() {
-					if thoughtSignature := partResult.Get("thoughtSignature"); thoughtSignature.Exists() && thoughtSignature.String() != "" {
-						output = output + "event: content_block_delta\n"
-						data, _ := sjson.Set(fmt.Sprintf(`{"type":"content_block_delta","index":%d,"delta":{"type":"signature_delta","signature":""}}`, state.ResponseIndex), "delta.signature", thoughtSignature.String())
-						output = output + fmt.Sprintf("data: %s\n\n\n", data)
-						state.HasContent = true
-					} else if state.ResponseType == 2 {
-						output = output + "event: content_block_delta\n"
-						data, _ := sjson.Set(fmt.Sprintf(`{"type":"content_block_delta","index":%d,"delta":{"type":"thinking_delta","thinking":""}}`, state.ResponseIndex), "delta.thinking", partTextResult.String())
-						output = output + fmt.Sprintf("data: %s\n\n\n", data)
-						state.HasContent = true
-					} else {
-						if state.ResponseType != 0 {
-							output = output + "event: content_block_stop\n"
-							output = output + fmt.Sprintf(`data: {"type":"content_block_stop","index":%d}`, state.ResponseIndex)
-							output = output + "\n\n\n"
-							state.ResponseIndex++
-						}
-						output = output + "event: content_block_start\n"
-						output = output + fmt.Sprintf(`data: {"type":"content_block_start","index":%d,"content_block":{"type":"thinking","thinking":""}}`, state.ResponseIndex)
-						output = output + "\n\n\n"
-						output = output + "event: content_block_delta\n"
-						data, _ := sjson.Set(fmt.Sprintf(`{"type":"content_block_delta","index":%d,"delta":{"type":"thinking_delta","thinking":""}}`, state.ResponseIndex), "delta.thinking", partTextResult.String())
-						output = output + fmt.Sprintf("data: %s\n\n\n", data)
-						state.ResponseType = 2
-						state.HasContent = true
+				if text := partTextResult.String(); text != "" {
+					if state.ResponseType != 2 {
+						appendClaudeBlockStart(state, &output, 2, `{"type":"thinking","thinking":""}`)
 					}
-				} else {
-					finishReasonResult := gjson.GetBytes(rawJSON, "response.candidates.0.finishReason")
-					if partTextResult.String() != "" || !finishReasonResult.Exists() {
-						if state.ResponseType == 1 {
-							output = output + "event: content_block_delta\n"
-							data, _ := sjson.Set(fmt.Sprintf(`{"type":"content_block_delta","index":%d,"delta":{"type":"text_delta","text":""}}`, state.ResponseIndex), "delta.text", partTextResult.String())
-							output = output + fmt.Sprintf("data: %s\n\n\n", data)
-							state.HasContent = true
-						} else {
-							if state.ResponseType != 0 {
-								output = output + "event: content_block_stop\n"
-								output = output + fmt.Sprintf(`data: {"type":"content_block_stop","index":%d}`, state.ResponseIndex)
-								output = output + "\n\n\n"
-								state.ResponseIndex++
-							}
-							if partTextResult.String() != "" {
-								output = output + "event: content_block_start\n"
-								output = output + fmt.Sprintf(`data: {"type":"content_block_start","index":%d,"content_block":{"type":"text","text":""}}`, state.ResponseIndex)
-								output = output + "\n\n\n"
-								output = output + "event: content_block_delta\n"
-								data, _ := sjson.Set(fmt.Sprintf(`{"type":"content_block_delta","index":%d,"delta":{"type":"text_delta","text":""}}`, state.ResponseIndex), "delta.text", partTextResult.String())
-								output = output + fmt.Sprintf("data: %s\n\n\n", data)
-								state.ResponseType = 1
-								state.HasContent = true
-							}
-						}
+					appendClaudeDelta(state, &output, "thinking_delta", "thinking", text)
+				}
+				if signature != "" {
+					appendClaudeSignature(modelName, state, &output, signature, opts)
+				}
+			} else if partTextResult.Exists() {
+				if signature != "" {
+					appendClaudeRedactedThinking(modelName, state, &output, signature, opts)
+				}
+				if text := partTextResult.String(); text != "" {
+					if state.ResponseType != 1 {
+						appendClaudeBlockStart(state, &output, 1, `{"type":"text","text":""}`)
+					}
+					appendClaudeDelta(state, &output, "text_delta", "text", text)
+					if len(opts.Documents) > 0 {
+						state.Text += text
 					}
 				}
 			} else if functionCallResult.Exists() {
-				state.HasToolUse = true
-				fcName := functionCallResult.Get("name").String()
-
-				if state.ResponseType == 3 {
-					output = output + "event: content_block_stop\n"
-					output = output + fmt.Sprintf(`data: {"type":"content_block_stop","index":%d}`, state.ResponseIndex)
-					output = output + "\n\n\n"
-					state.ResponseIndex++
-					state.ResponseType = 0
-				}
-
-				if state.ResponseType != 0 {
-					output = output + "event: content_block_stop\n"
-					output = output + fmt.Sprintf(`data: {"type":"content_block_stop","index":%d}`, state.ResponseIndex)
-					output = output + "\n\n\n"
-					state.ResponseIndex++
+				if signature != "" {
+					appendClaudeRedactedThinking(modelName, state, &output, signature, opts)
 				}
+				state.HasToolUse = true
+				fcName := opts.toolName(functionCallResult.Get("name").String())
 
-				output = output + "event: content_block_start\n"
-				data := fmt.Sprintf(`{"type":"content_block_start","index":%d,"content_block":{"type":"tool_use","id":"","name":"","input":{}}}`, state.ResponseIndex)
-				data, _ = sjson.Set(data, "content_block.id", fmt.Sprintf("%s-%d-%d", fcName, time.Now().UnixNano(), atomic.AddUint64(&claudeToolUseIDCounter, 1)))
-				data, _ = sjson.Set(data, "content_block.name", fcName)
-				output = output + fmt.Sprintf("data: %s\n\n\n", data)
+				toolUse := `{"type":"tool_use","id":"","name":"","input":{}}`
+				toolUse, _ = sjson.Set(toolUse, "id", toolCallID(claudeToolUseIDPrefix, functionCallResult, gjson.GetBytes(rawJSON, "response.responseId").String(), state.ToolUseCount))
+				state.ToolUseCount++
+				toolUse, _ = sjson.Set(toolUse, "name", fcName)
+				appendClaudeBlockStart(state, &output, 3, toolUse)
 
 				if fcArgsResult := functionCallResult.Get("args"); fcArgsResult.Exists() {
-					output = output + "event: content_block_delta\n"
-					data, _ = sjson.Set(fmt.Sprintf(`{"type":"content_block_delta","index":%d,"delta":{"type":"input_json_delta","partial_json":""}}`, state.ResponseIndex), "delta.partial_json", fcArgsResult.Raw)
-					output = output + fmt.Sprintf("data: %s\n\n\n", data)
+					for _, fragment := range splitToolArguments(fcArgsResult.Raw) {
+						appendClaudeDelta(state, &output, "input_json_delta", "partial_json", fragment)
+					}
 				}
-				state.ResponseType = 3
-				state.HasContent = true
 			}
 		}
 	}
 
+	// Attach citations of the request's documents to the open text block
+	if len(opts.Documents) > 0 && state.ResponseType == 1 {
+		sources := citationSources(gjson.GetBytes(rawJSON, "response.candidates.0"))
+		for _, citation := range documentCitations(state.Text, sources, opts.Documents) {
+			key := fmt.Sprintf("%v:%v:%v", citation["document_index"], citation["start_char_index"], citation["end_char_index"])
+			if state.Citations[key] {
+				continue
+			}
+			if state.Citations == nil {
+				state.Citations = map[string]bool{}
+			}
+			state.Citations[key] = true
+			data := fmt.Sprintf(`{"type":"content_block_delta","index":%d,"delta":{"type":"citations_delta"}}`, state.ResponseIndex)
+			data, _ = sjson.Set(data, "delta.citation", citation)
+			appendClaudeEvent(&output, "content_block_delta", data)
+		}
+	}
+
 	if finishReasonResult := gjson.GetBytes(rawJSON, "response.candidates.0.finishReason"); finishReasonResult.Exists() {
 		state.HasFinishReason = true
 		state.FinishReason = finishReasonResult.String()
 	}
+	if native, refusal, ok := refusalReason(gjson.GetBytes(rawJSON, "response")); ok {
+		state.HasFinishReason = true
+		state.FinishReason = native
+		state.Refused = true
+		state.SafetyRatings = blockedSafetyRatings(gjson.GetBytes(rawJSON, "response"))
+		// Explain a refusal that produced no content
+		if !state.HasContent {
+			appendClaudeBlockStart(state, &output, 1, `{"type":"text","text":""}`)
+			appendClaudeDelta(state, &output, "text_delta", "text", refusal)
+		}
+	}
 
 	if usageResult := gjson.GetBytes(rawJSON, "response.usageMetadata"); usageResult.Exists() {
 		state.HasUsageMetadata = true
 		state.PromptTokenCount = usageResult.Get("promptTokenCount").Int()
+		state.CachedTokenCount = usageResult.Get("cachedContentTokenCount").Int()
 		state.CandidatesTokenCount = usageResult.Get("candidatesTokenCount").Int()
 		state.ThoughtsTokenCount = usageResult.Get("thoughtsTokenCount").Int()
 		state.TotalTokenCount = usageResult.Get("totalTokenCount").Int()
@@ -185,29 +266,21 @@ func ConvertAntigravityResponseToClaude(modelName string, rawJSON []byte, state
 	}
 
 	if state.HasUsageMetadata && state.HasFinishReason {
-		appendClaudeFinalEvents(state, &output, false)
+		appendClaudeFinalEvents(state, &output, false, opts)
 	}
 
 	return []string{output}
 }
 
-func appendClaudeFinalEvents(state *ClaudeStreamState, output *string, force bool) {
+func appendClaudeFinalEvents(state *ClaudeStreamState, output *string, force bool, opts *TranslatorOptions) {
 	if state.HasSentFinalEvents {
 		return
 	}
 	if !state.HasUsageMetadata && !force {
 		return
 	}
-	if !state.HasContent {
-		return
-	}
 
-	if state.ResponseType != 0 {
-		*output = *output + "event: content_block_stop\n"
-		*output = *output + fmt.Sprintf(`data: {"type":"content_block_stop","index":%d}`, state.ResponseIndex)
-		*output = *output + "\n\n\n"
-		state.ResponseType = 0
-	}
+	appendClaudeBlockStop(state, output)
 
 	stopReason := resolveClaudeStopReason(state)
 	usageOutputTokens := state.CandidatesTokenCount + state.ThoughtsTokenCount
@@ -218,31 +291,46 @@ func appendClaudeFinalEvents(state *ClaudeStreamState, output *string, force boo
 		}
 	}
 
-	*output = *output + "event: message_delta\n"
-	*output = *output + "data: "
-	delta := fmt.Sprintf(`{"type":"message_delta","delta":{"stop_reason":"%s","stop_sequence":null},"usage":{"input_tokens":%d,"output_tokens":%d}}`, stopReason, state.PromptTokenCount, usageOutputTokens)
-	*output = *output + delta + "\n\n\n"
+	promptTokens := state.PromptTokenCount
+	if !state.HasUsageMetadata {
+		promptTokens = state.InputTokens
+	}
+	inputTokens, cacheReadTokens := claudeInputUsage(promptTokens, state.CachedTokenCount)
+	delta := fmt.Sprintf(`{"type":"message_delta","delta":{"stop_reason":"%s","stop_sequence":null},"usage":{"input_tokens":%d,"cache_creation_input_tokens":0,"cache_read_input_tokens":%d,"output_tokens":%d}}`, stopReason, inputTokens, cacheReadTokens, usageOutputTokens)
+	if opts.ExtensionFields && state.FinishReason != "" {
+		delta, _ = sjson.Set(delta, "delta.native_finish_reason", strings.ToLower(state.FinishReason))
+	}
+	if opts.ExtensionFields && state.SafetyRatings != "" {
+		delta, _ = sjson.SetRaw(delta, "delta.safety_ratings", state.SafetyRatings)
+	}
+	appendClaudeEvent(output, "message_delta", delta)
 
 	state.HasSentFinalEvents = true
 }
 
+// claudeInputUsage splits upstream prompt tokens into Anthropic's uncached
+// input and cache read token counts. The upstream caches prefixes implicitly
+// and does not report cache writes, so cache_creation_input_tokens is always 0.
+func claudeInputUsage(promptTokens, cachedTokens int64) (input, cacheRead int64) {
+	return max(promptTokens-cachedTokens, 0), cachedTokens
+}
+
 func resolveClaudeStopReason(state *ClaudeStreamState) string {
-	if state.HasToolUse {
-		return "tool_use"
-	}
-	switch state.FinishReason {
-	case "MAX_TOKENS":
-		return "max_tokens"
-	case "STOP", "FINISH_REASON_UNSPECIFIED", "UNKNOWN":
-		return "end_turn"
+	if state.Refused {
+		return "refusal"
 	}
-	return "end_turn"
+	return ClaudeStopReason(state.FinishReason, state.HasToolUse)
 }
 
 // ConvertAntigravityResponseToClaudeNonStream converts a non-streaming response to Claude format.
-func ConvertAntigravityResponseToClaudeNonStream(modelName string, rawJSON []byte) string {
+func ConvertAntigravityResponseToClaudeNonStream(modelName string, rawJSON []byte, opts *TranslatorOptions) string {
+	if opts == nil {
+		opts = &TranslatorOptions{}
+	}
+
 	root := gjson.ParseBytes(rawJSON)
 	promptTokens := root.Get("response.usageMetadata.promptTokenCount").Int()
+	cachedTokens := root.Get("response.usageMetadata.cachedContentTokenCount").Int()
 	candidateTokens := root.Get("response.usageMetadata.candidatesTokenCount").Int()
 	thoughtTokens := root.Get("response.usageMetadata.thoughtsTokenCount").Int()
 	totalTokens := root.Get("response.usageMetadata.totalTokenCount").Int()
@@ -254,17 +342,22 @@ func ConvertAntigravityResponseToClaudeNonStream(modelName string, rawJSON []byt
 		}
 	}
 
+	inputTokens, cacheReadTokens := claudeInputUsage(promptTokens, cachedTokens)
+	upstreamModel := models.Alias2ModelName(modelName)
+
 	response := map[string]interface{}{
-		"id":            root.Get("response.responseId").String(),
+		"id":            NewClaudeMessageID(),
 		"type":          "message",
 		"role":          "assistant",
-		"model":         root.Get("response.modelVersion").String(),
+		"model":         modelName,
 		"content":       []interface{}{},
 		"stop_reason":   nil,
 		"stop_sequence": nil,
 		"usage": map[string]interface{}{
-			"input_tokens":  promptTokens,
-			"output_tokens": outputTokens,
+			"input_tokens":                inputTokens,
+			"cache_creation_input_tokens": 0,
+			"cache_read_input_tokens":     cacheReadTokens,
+			"output_tokens":               outputTokens,
 		},
 	}
 
@@ -275,51 +368,107 @@ func ConvertAntigravityResponseToClaudeNonStream(modelName string, rawJSON []byt
 	toolIDCounter := 0
 	hasToolCall := false
 
+	// Map citations back to the request's documents. Each citation goes to
+	// the first text block holding the cited passage.
+	var citations []map[string]interface{}
+	if len(opts.Documents) > 0 {
+		var text strings.Builder
+		for _, part := range parts.Array() {
+			if !part.Get("thought").Bool() {
+				text.WriteString(part.Get("text").String())
+			}
+		}
+		citations = documentCitations(text.String(), citationSources(root.Get("response.candidates.0")), opts.Documents)
+	}
+
 	flushText := func() {
 		if textBuilder.Len() == 0 {
 			return
 		}
-		contentBlocks = append(contentBlocks, map[string]interface{}{
+		block := map[string]interface{}{
 			"type": "text",
 			"text": textBuilder.String(),
-		})
+		}
+		var blockCitations, remaining []map[string]interface{}
+		for _, citation := range citations {
+			if strings.Contains(textBuilder.String(), citation["cited_text"].(string)) {
+				blockCitations = append(blockCitations, citation)
+			} else {
+				remaining = append(remaining, citation)
+			}
+		}
+		if len(blockCitations) > 0 {
+			block["citations"] = blockCitations
+			citations = remaining
+		}
+		contentBlocks = append(contentBlocks, block)
 		textBuilder.Reset()
 	}
 
+	thinkingSignature := ""
 	flushThinking := func() {
-		if thinkingBuilder.Len() == 0 {
+		if thinkingBuilder.Len() == 0 && thinkingSignature == "" {
 			return
 		}
-		contentBlocks = append(contentBlocks, map[string]interface{}{
+		block := map[string]interface{}{
 			"type":     "thinking",
 			"thinking": thinkingBuilder.String(),
-		})
+		}
+		if thinkingSignature != "" {
+			block["signature"] = thinkingSignature
+		}
+		contentBlocks = append(contentBlocks, block)
 		thinkingBuilder.Reset()
+		thinkingSignature = ""
+	}
+
+	// addRedactedThinking emits a signature attached to a text or tool call
+	// part as a redacted_thinking block ahead of that part.
+	addRedactedThinking := func(signature string) {
+		if signature == "" {
+			return
+		}
+		flushThinking()
+		flushText()
+		contentBlocks = append(contentBlocks, map[string]interface{}{
+			"type": "redacted_thinking",
+			"data": opts.Signatures.Wrap(upstreamModel, signature),
+		})
 	}
 
 	if parts.IsArray() {
 		for _, part := range parts.Array() {
-			if text := part.Get("text"); text.Exists() && text.String() != "" {
+			signature := part.Get("thoughtSignature").String()
+			if text := part.Get("text"); text.Exists() {
 				if part.Get("thought").Bool() {
 					flushText()
 					thinkingBuilder.WriteString(text.String())
+					if signature != "" {
+						if thinkingBuilder.Len() == 0 {
+							addRedactedThinking(signature)
+							continue
+						}
+						thinkingSignature = opts.Signatures.Wrap(upstreamModel, signature)
+						flushThinking()
+					}
 					continue
 				}
+				addRedactedThinking(signature)
 				flushThinking()
 				textBuilder.WriteString(text.String())
 				continue
 			}
 
 			if functionCall := part.Get("functionCall"); functionCall.Exists() {
+				addRedactedThinking(signature)
 				flushThinking()
 				flushText()
 				hasToolCall = true
 
-				name := functionCall.Get("name").String()
-				toolIDCounter++
+				name := opts.toolName(functionCall.Get("name").String())
 				toolBlock := map[string]interface{}{
 					"type":  "tool_use",
-					"id":    fmt.Sprintf("tool_%d", toolIDCounter),
+					"id":    toolCallID(claudeToolUseIDPrefix, functionCall, root.Get("response.responseId").String(), toolIDCounter),
 					"name":  name,
 					"input": map[string]interface{}{},
 				}
@@ -332,6 +481,7 @@ func ConvertAntigravityResponseToClaudeNonStream(modelName string, rawJSON []byt
 				}
 
 				contentBlocks = append(contentBlocks, toolBlock)
+				toolIDCounter++
 				continue
 			}
 		}
@@ -342,21 +492,25 @@ func ConvertAntigravityResponseToClaudeNonStream(modelName string, rawJSON []byt
 
 	response["content"] = contentBlocks
 
-	stopReason := "end_turn"
-	if hasToolCall {
-		stopReason = "tool_use"
-	} else {
-		if finish := root.Get("response.candidates.0.finishReason"); finish.Exists() {
-			switch finish.String() {
-			case "MAX_TOKENS":
-				stopReason = "max_tokens"
-			case "STOP", "FINISH_REASON_UNSPECIFIED", "UNKNOWN":
-				stopReason = "end_turn"
-			default:
-				stopReason = "end_turn"
-			}
+	native := root.Get("response.candidates.0.finishReason").String()
+	stopReason := ClaudeStopReason(native, hasToolCall)
+	if blockedReason, refusal, ok := refusalReason(root.Get("response")); ok {
+		native = blockedReason
+		stopReason = "refusal"
+		if ratings := blockedSafetyRatings(root.Get("response")); ratings != "" && opts.ExtensionFields {
+			response["safety_ratings"] = json.RawMessage(ratings)
+		}
+		// Explain a refusal that produced no content
+		if len(contentBlocks) == 0 {
+			response["content"] = []interface{}{map[string]interface{}{
+				"type": "text",
+				"text": refusal,
+			}}
 		}
 	}
+	if native != "" && opts.ExtensionFields {
+		response["native_finish_reason"] = strings.ToLower(native)
+	}
 	response["stop_reason"] = stopReason
 
 	encoded, err := json.Marshal(response)
@@ -0,0 +1,110 @@
+package translator
+
+import (
+	"encoding/base64"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/tidwall/gjson"
+)
+
+// Document is a document block of a Claude request, in request order, whose
+// citations can be mapped back to it.
+type Document struct {
+	Title string
+
+	// Text is the plain text of a document with citations enabled, or "" when
+	// citations are disabled or the text is unknown (e.g. PDFs).
+	Text string
+}
+
+// Documents returns the document blocks of a Claude request, indexed the way
+// Claude citations refer to them. It is passed to the response translators in
+// TranslatorOptions.Documents.
+func Documents(rawJSON []byte) []Document {
+	var documents []Document
+	for _, message := range gjson.GetBytes(rawJSON, "messages").Array() {
+		for _, block := range message.Get("content").Array() {
+			if block.Get("type").String() != "document" {
+				continue
+			}
+			document := Document{Title: block.Get("title").String()}
+			if block.Get("citations.enabled").Bool() {
+				document.Text = documentText(block.Get("source"))
+			}
+			documents = append(documents, document)
+		}
+	}
+	return documents
+}
+
+// documentText returns the plain text of a document source, if it has any.
+func documentText(source gjson.Result) string {
+	switch source.Get("type").String() {
+	case "text":
+		return source.Get("data").String()
+	case "base64":
+		if !strings.HasPrefix(source.Get("media_type").String(), "text/") {
+			return ""
+		}
+		if text, err := base64.StdEncoding.DecodeString(source.Get("data").String()); err == nil && utf8.Valid(text) {
+			return string(text)
+		}
+	case "content":
+		var texts []string
+		for _, item := range source.Get("content").Array() {
+			if text := item.Get("text").String(); text != "" {
+				texts = append(texts, text)
+			}
+		}
+		return strings.Join(texts, "")
+	}
+	return ""
+}
+
+// citationSources returns the citation sources of an upstream candidate.
+func citationSources(candidate gjson.Result) []gjson.Result {
+	if sources := candidate.Get("citationMetadata.citationSources"); sources.Exists() {
+		return sources.Array()
+	}
+	return candidate.Get("citationMetadata.citations").Array()
+}
+
+// documentCitations maps upstream citation sources, which locate cited
+// passages in the response text, back to Claude char_location citations of
+// the request's documents. Sources whose passage is not found verbatim in a
+// document with citations enabled are skipped.
+func documentCitations(text string, sources []gjson.Result, documents []Document) []map[string]interface{} {
+	var citations []map[string]interface{}
+	for _, source := range sources {
+		start, end := int(source.Get("startIndex").Int()), int(source.Get("endIndex").Int())
+		if start < 0 || end > len(text) || start >= end {
+			continue
+		}
+		cited := strings.TrimSpace(strings.ToValidUTF8(text[start:end], ""))
+		if cited == "" {
+			continue
+		}
+		for i, document := range documents {
+			offset := strings.Index(document.Text, cited)
+			if document.Text == "" || offset < 0 {
+				continue
+			}
+			startChar := utf8.RuneCountInString(document.Text[:offset])
+			citation := map[string]interface{}{
+				"type":             "char_location",
+				"cited_text":       cited,
+				"document_index":   i,
+				"document_title":   nil,
+				"start_char_index": startChar,
+				"end_char_index":   startChar + utf8.RuneCountInString(cited),
+			}
+			if document.Title != "" {
+				citation["document_title"] = document.Title
+			}
+			citations = append(citations, citation)
+			break
+		}
+	}
+	return citations
+}
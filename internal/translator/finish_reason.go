@@ -0,0 +1,109 @@
+package translator
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/tidwall/gjson"
+)
+
+// finishReason maps a Gemini finish reason onto the client formats.
+type finishReason struct {
+	openAI  string
+	claude  string
+	refusal bool // The response was cut off by a content filter
+}
+
+// finishReasons is the mapping shared by all translators. Gemini reports stop
+// sequences as STOP, so they map to stop/end_turn like a natural end.
+var finishReasons = map[string]finishReason{
+	"STOP":                      {openAI: "stop", claude: "end_turn"},
+	"MAX_TOKENS":                {openAI: "length", claude: "max_tokens"},
+	"SAFETY":                    {openAI: "content_filter", claude: "refusal", refusal: true},
+	"RECITATION":                {openAI: "content_filter", claude: "refusal", refusal: true},
+	"BLOCKLIST":                 {openAI: "content_filter", claude: "refusal", refusal: true},
+	"PROHIBITED_CONTENT":        {openAI: "content_filter", claude: "refusal", refusal: true},
+	"SPII":                      {openAI: "content_filter", claude: "refusal", refusal: true},
+	"IMAGE_SAFETY":              {openAI: "content_filter", claude: "refusal", refusal: true},
+	"MALFORMED_FUNCTION_CALL":   {openAI: "stop", claude: "end_turn"},
+	"UNEXPECTED_TOOL_CALL":      {openAI: "stop", claude: "end_turn"},
+	"LANGUAGE":                  {openAI: "stop", claude: "end_turn"},
+	"OTHER":                     {openAI: "stop", claude: "end_turn"},
+	"FINISH_REASON_UNSPECIFIED": {openAI: "stop", claude: "end_turn"},
+}
+
+// lookupFinishReason returns the mapping for a Gemini finish reason, treating
+// unknown reasons as a natural end.
+func lookupFinishReason(native string) finishReason {
+	if reason, ok := finishReasons[strings.ToUpper(native)]; ok {
+		return reason
+	}
+	return finishReasons["STOP"]
+}
+
+// OpenAIFinishReason maps a Gemini finish reason to an OpenAI finish_reason.
+func OpenAIFinishReason(native string, hasToolCalls bool) string {
+	reason := lookupFinishReason(native)
+	if hasToolCalls && !reason.refusal && reason.openAI == "stop" {
+		return "tool_calls"
+	}
+	return reason.openAI
+}
+
+// ClaudeStopReason maps a Gemini finish reason to an Anthropic stop_reason.
+func ClaudeStopReason(native string, hasToolUse bool) string {
+	reason := lookupFinishReason(native)
+	if hasToolUse && !reason.refusal && reason.claude == "end_turn" {
+		return "tool_use"
+	}
+	return reason.claude
+}
+
+// refusalReason reports why a response was blocked, either because the prompt
+// was rejected (promptFeedback.blockReason) or because the candidate was cut
+// off by a content filter. It returns the native reason and a message naming
+// the safety categories involved.
+func refusalReason(response gjson.Result) (native, message string, ok bool) {
+	if blockReason := response.Get("promptFeedback.blockReason").String(); blockReason != "" {
+		message = "The prompt was blocked by the upstream content filter (" + blockReason + ")"
+		return blockReason, withSafetyCategories(message, response.Get("promptFeedback.safetyRatings")), true
+	}
+
+	native = response.Get("candidates.0.finishReason").String()
+	if !lookupFinishReason(native).refusal {
+		return "", "", false
+	}
+	message = "The response was blocked by the upstream content filter (" + native + ")"
+	return native, withSafetyCategories(message, response.Get("candidates.0.safetyRatings")), true
+}
+
+// blockedSafetyRatings returns the raw safety ratings of a blocked prompt or
+// response, or "" if there are none.
+func blockedSafetyRatings(response gjson.Result) string {
+	if response.Get("promptFeedback.blockReason").String() != "" {
+		return response.Get("promptFeedback.safetyRatings").Raw
+	}
+	return response.Get("candidates.0.safetyRatings").Raw
+}
+
+// withSafetyCategories appends the blocked, or otherwise likely, harm
+// categories from safety ratings to message.
+func withSafetyCategories(message string, ratings gjson.Result) string {
+	var blocked, likely []string
+	for _, rating := range ratings.Array() {
+		category := fmt.Sprintf("%s: %s", rating.Get("category").String(), rating.Get("probability").String())
+		switch {
+		case rating.Get("blocked").Bool():
+			blocked = append(blocked, category)
+		case rating.Get("probability").String() == "HIGH" || rating.Get("probability").String() == "MEDIUM":
+			likely = append(likely, category)
+		}
+	}
+	if len(blocked) == 0 {
+		blocked = likely
+	}
+	if len(blocked) == 0 {
+		return message + "."
+	}
+	return message + ": " + strings.Join(blocked, ", ") + "."
+}
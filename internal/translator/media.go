@@ -0,0 +1,152 @@
+package translator
+
+import (
+	"encoding/base64"
+	"mime"
+	"path"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/anthropics/antigravity-wrapper/internal/media"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// imagePart converts an image content block into an inlineData part. It
+// accepts Claude image blocks with a base64 source and OpenAI image_url blocks
+// holding a data URL, and reports false for anything else.
+func imagePart(block gjson.Result) (string, bool) {
+	var mimeType, data string
+	switch block.Get("type").String() {
+	case "image":
+		source := block.Get("source")
+		if source.Get("type").String() != "base64" {
+			return "", false
+		}
+		mimeType, data = source.Get("media_type").String(), source.Get("data").String()
+	case "image_url":
+		var ok bool
+		if mimeType, data, ok = parseDataURL(block.Get("image_url.url").String()); !ok {
+			return "", false
+		}
+	default:
+		return "", false
+	}
+	if data == "" {
+		return "", false
+	}
+	return inlineDataPart(mimeType, data), true
+}
+
+// audioPart converts an OpenAI input_audio content part into an inlineData
+// part, and reports false for unsupported formats.
+func audioPart(block gjson.Result) (string, bool) {
+	mimeType, ok := media.AudioMIMEType(block.Get("input_audio.format").String())
+	data := block.Get("input_audio.data").String()
+	if !ok || data == "" {
+		return "", false
+	}
+	return inlineDataPart(mimeType, data), true
+}
+
+// documentParts converts a Claude document block into parts. PDFs become
+// inlineData parts and text documents text parts. The document's title and
+// context are passed ahead of its content.
+func documentParts(block gjson.Result) []string {
+	var parts []string
+	source := block.Get("source")
+	switch source.Get("type").String() {
+	case "base64":
+		if data := source.Get("data").String(); data != "" {
+			parts = append(parts, fileDataPart(source.Get("media_type").String(), data))
+		}
+	case "text":
+		if text := source.Get("data").String(); text != "" {
+			parts = append(parts, textPart(text))
+		}
+	case "content":
+		for _, item := range source.Get("content").Array() {
+			if part, ok := imagePart(item); ok {
+				parts = append(parts, part)
+			} else if text := item.Get("text").String(); text != "" {
+				parts = append(parts, textPart(text))
+			}
+		}
+	}
+	if len(parts) == 0 {
+		return nil
+	}
+
+	var header []string
+	if title := block.Get("title").String(); title != "" {
+		header = append(header, "Document: "+title)
+	}
+	if context := block.Get("context").String(); context != "" {
+		header = append(header, context)
+	}
+	if len(header) > 0 {
+		parts = append([]string{textPart(strings.Join(header, "\n"))}, parts...)
+	}
+	return parts
+}
+
+// filePart converts an OpenAI file content part carrying file_data, either a
+// data URL or plain base64 whose type is taken from the filename.
+func filePart(block gjson.Result) (string, bool) {
+	fileData := block.Get("file.file_data").String()
+	if fileData == "" {
+		return "", false
+	}
+	if mimeType, data, ok := parseDataURL(fileData); ok {
+		return fileDataPart(mimeType, data), true
+	}
+	mimeType, _, _ := mime.ParseMediaType(mime.TypeByExtension(path.Ext(block.Get("file.filename").String())))
+	if mimeType == "" {
+		mimeType = "application/pdf"
+	}
+	return fileDataPart(mimeType, fileData), true
+}
+
+// fileDataPart returns a part for base64 file data. Text files are decoded
+// into text parts; other files are sent as inlineData.
+func fileDataPart(mimeType, data string) string {
+	if strings.HasPrefix(mimeType, "text/") {
+		if text, err := base64.StdEncoding.DecodeString(data); err == nil && utf8.Valid(text) {
+			return textPart(string(text))
+		}
+	}
+	return inlineDataPart(mimeType, data)
+}
+
+// textPart returns a text part.
+func textPart(text string) string {
+	part, _ := sjson.Set(`{}`, "text", text)
+	return part
+}
+
+// inlineDataPart returns an inlineData part holding base64 data.
+func inlineDataPart(mimeType, data string) string {
+	part := `{"inlineData":{}}`
+	if mimeType != "" {
+		part, _ = sjson.Set(part, "inlineData.mime_type", mimeType)
+	}
+	part, _ = sjson.Set(part, "inlineData.data", data)
+	return part
+}
+
+// parseDataURL splits a base64 data URL into its media type and data.
+func parseDataURL(url string) (mimeType, data string, ok bool) {
+	rest, ok := strings.CutPrefix(url, "data:")
+	if !ok {
+		return "", "", false
+	}
+	meta, data, ok := strings.Cut(rest, ",")
+	if !ok {
+		return "", "", false
+	}
+	mimeType, ok = strings.CutSuffix(meta, ";base64")
+	if !ok {
+		return "", "", false
+	}
+	return mimeType, data, true
+}
@@ -1,3 +1,4 @@
+// Package translator provides format conversion between different API formats.
 package translator
 
 import (
@@ -30,6 +31,20 @@ func ConvertOpenAIRequestToAntigravity(modelName string, inputRawJSON []byte, st
 		out = models.ApplyReasoningEffortToPayload(modelName, out, re.String())
 	}
 
+	// Responses-style reasoning object: {effort, summary}
+	if r := gjson.GetBytes(rawJSON, "reasoning"); r.IsObject() && models.ModelSupportsThinking(modelName) {
+		if effort := r.Get("effort"); effort.Exists() && !hasOfficialThinking {
+			hasOfficialThinking = true
+			if !models.ModelUsesThinkingLevels(modelName) {
+				out = models.ApplyReasoningEffortToPayload(modelName, out, effort.String())
+			}
+		}
+		// A requested summary needs the thoughts it is made from
+		if summary := r.Get("summary").String(); summary != "" && summary != "none" {
+			out, _ = sjson.SetBytes(out, "request.generationConfig.thinkingConfig.include_thoughts", true)
+		}
+	}
+
 	// Cherry Studio extension extra_body.google.thinking_config
 	if !hasOfficialThinking && models.ModelSupportsThinking(modelName) && !models.ModelUsesThinkingLevels(modelName) {
 		if tc := gjson.GetBytes(rawJSON, "extra_body.google.thinking_config"); tc.Exists() && tc.IsObject() {
@@ -82,6 +97,11 @@ func ConvertOpenAIRequestToAntigravity(modelName string, inputRawJSON []byte, st
 	if maxTok := gjson.GetBytes(rawJSON, "max_tokens"); maxTok.Exists() && maxTok.Type == gjson.Number {
 		out, _ = sjson.SetBytes(out, "request.generationConfig.maxOutputTokens", maxTok.Num)
 	}
+	if stop := gjson.GetBytes(rawJSON, "stop"); stop.Type == gjson.String {
+		out, _ = sjson.SetBytes(out, "request.generationConfig.stopSequences", []string{stop.String()})
+	} else if stop.IsArray() && len(stop.Array()) > 0 {
+		out, _ = sjson.SetRawBytes(out, "request.generationConfig.stopSequences", []byte(stop.Raw))
+	}
 
 	// Map OpenAI modalities -> Gemini CLI responseModalities
 	if mods := gjson.GetBytes(rawJSON, "modalities"); mods.Exists() && mods.IsArray() {
@@ -135,15 +155,14 @@ func ConvertOpenAIRequestToAntigravity(modelName string, inputRawJSON []byte, st
 		}
 
 		// Second pass: build systemInstruction/tool responses cache
-		toolResponses := map[string]string{}
+		toolResponses := map[string]gjson.Result{}
 		for i := 0; i < len(arr); i++ {
 			m := arr[i]
 			role := m.Get("role").String()
 			if role == "tool" {
 				toolCallID := m.Get("tool_call_id").String()
 				if toolCallID != "" {
-					c := m.Get("content")
-					toolResponses[toolCallID] = c.Raw
+					toolResponses[toolCallID] = m.Get("content")
 				}
 			}
 		}
@@ -174,16 +193,19 @@ func ConvertOpenAIRequestToAntigravity(modelName string, inputRawJSON []byte, st
 							node, _ = sjson.SetBytes(node, "parts."+itoa(p)+".text", item.Get("text").String())
 							p++
 						case "image_url":
-							imageURL := item.Get("image_url.url").String()
-							if len(imageURL) > 5 {
-								pieces := strings.SplitN(imageURL[5:], ";", 2)
-								if len(pieces) == 2 && len(pieces[1]) > 7 {
-									mime := pieces[0]
-									data := pieces[1][7:]
-									node, _ = sjson.SetBytes(node, "parts."+itoa(p)+".inlineData.mime_type", mime)
-									node, _ = sjson.SetBytes(node, "parts."+itoa(p)+".inlineData.data", data)
-									p++
-								}
+							if part, ok := imagePart(item); ok {
+								node, _ = sjson.SetRawBytes(node, "parts."+itoa(p), []byte(part))
+								p++
+							}
+						case "file":
+							if part, ok := filePart(item); ok {
+								node, _ = sjson.SetRawBytes(node, "parts."+itoa(p), []byte(part))
+								p++
+							}
+						case "input_audio":
+							if part, ok := audioPart(item); ok {
+								node, _ = sjson.SetRawBytes(node, "parts."+itoa(p), []byte(part))
+								p++
 							}
 						}
 					}
@@ -192,14 +214,17 @@ func ConvertOpenAIRequestToAntigravity(modelName string, inputRawJSON []byte, st
 			} else if role == "assistant" {
 				node := []byte(`{"role":"model","parts":[]}`)
 				p := 0
+				// Tool calls -> single model content with functionCall parts, after
+				// any text content of the same message
+				tcs := m.Get("tool_calls")
 				if content.Type == gjson.String {
 					node, _ = sjson.SetBytes(node, "parts.-1.text", content.String())
-					out, _ = sjson.SetRawBytes(out, "request.contents.-1", node)
+					if !tcs.IsArray() {
+						out, _ = sjson.SetRawBytes(out, "request.contents.-1", node)
+					}
 					p++
 				}
 
-				// Tool calls -> single model content with functionCall parts
-				tcs := m.Get("tool_calls")
 				if tcs.IsArray() {
 					fIDs := make([]string, 0)
 					for _, tc := range tcs.Array() {
@@ -209,8 +234,8 @@ func ConvertOpenAIRequestToAntigravity(modelName string, inputRawJSON []byte, st
 						fid := tc.Get("id").String()
 						fname := tc.Get("function.name").String()
 						fargs := tc.Get("function.arguments").String()
-						node, _ = sjson.SetBytes(node, "parts."+itoa(p)+".functionCall.id", fid)
-						node, _ = sjson.SetBytes(node, "parts."+itoa(p)+".functionCall.name", fname)
+						node, _ = sjson.SetBytes(node, "parts."+itoa(p)+".functionCall.id", upstreamToolCallID(fid))
+						node, _ = sjson.SetBytes(node, "parts."+itoa(p)+".functionCall.name", sanitizeToolName(fname))
 						node, _ = sjson.SetRawBytes(node, "parts."+itoa(p)+".functionCall.args", []byte(fargs))
 						node, _ = sjson.SetBytes(node, "parts."+itoa(p)+".thoughtSignature", geminiCLIFunctionThoughtSignature)
 						p++
@@ -225,20 +250,16 @@ func ConvertOpenAIRequestToAntigravity(modelName string, inputRawJSON []byte, st
 					pp := 0
 					for _, fid := range fIDs {
 						if name, ok := tcID2Name[fid]; ok {
-							toolNode, _ = sjson.SetBytes(toolNode, "parts."+itoa(pp)+".functionResponse.id", fid)
-							toolNode, _ = sjson.SetBytes(toolNode, "parts."+itoa(pp)+".functionResponse.name", name)
+							// Tool results are strings, JSON documents or arrays of
+							// content parts
 							resp := toolResponses[fid]
-							if resp == "" {
-								resp = "{}"
-							}
-							if resp != "null" {
-								parsed := gjson.Parse(resp)
-								if parsed.Type == gjson.JSON {
-									toolNode, _ = sjson.SetRawBytes(toolNode, "parts."+itoa(pp)+".functionResponse.response.result", []byte(parsed.Raw))
-								} else {
-									toolNode, _ = sjson.SetBytes(toolNode, "parts."+itoa(pp)+".functionResponse.response.result", resp)
+							if resp.Type == gjson.String && gjson.Valid(resp.String()) {
+								if parsed := gjson.Parse(resp.String()); parsed.IsObject() || parsed.IsArray() {
+									resp = parsed
 								}
 							}
+							part := functionResponsePart(upstreamToolCallID(fid), sanitizeToolName(name), resp, false)
+							toolNode, _ = sjson.SetRawBytes(toolNode, "parts."+itoa(pp), []byte(part))
 							pp++
 						}
 					}
@@ -275,6 +296,7 @@ func ConvertOpenAIRequestToAntigravity(modelName string, inputRawJSON []byte, st
 						fnRaw, _ = sjson.Set(fnRaw, "parametersJsonSchema.properties", map[string]interface{}{})
 					}
 					fnRaw, _ = sjson.Delete(fnRaw, "strict")
+					fnRaw, _ = sjson.Set(fnRaw, "name", sanitizeToolName(fn.Get("name").String()))
 					if !hasFunction {
 						toolNode, _ = sjson.SetRawBytes(toolNode, "functionDeclarations", []byte("[]"))
 					}
@@ -294,7 +316,7 @@ func ConvertOpenAIRequestToAntigravity(modelName string, inputRawJSON []byte, st
 		}
 	}
 
-	return AttachDefaultSafetySettings(out, "request.safetySettings")
+	return out
 }
 
 func itoa(i int) string { return fmt.Sprintf("%d", i) }
@@ -5,9 +5,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"strings"
-	"sync/atomic"
 	"time"
 
+	"github.com/anthropics/antigravity-wrapper/internal/thoughtsig"
 	"github.com/tidwall/gjson"
 	"github.com/tidwall/sjson"
 )
@@ -21,10 +21,34 @@ type OpenAIStreamState struct {
 
 // TranslatorOptions configures the translation behavior.
 type TranslatorOptions struct {
-	ThinkingAsContent bool
+	// ThinkingOutput selects how OpenAI responses carry thoughts; see the
+	// ThinkingOutput* modes. Empty means ThinkingOutputReasoning.
+	ThinkingOutput string
+
+	// Signatures wraps thought signatures handed to Claude clients and
+	// unwraps the ones they send back.
+	Signatures *thoughtsig.Signer
+
+	// ToolNames maps sanitized function names back to the client's tool
+	// names; see ToolNames.
+	ToolNames map[string]string
+
+	// Documents are the document blocks of a Claude request, used to map
+	// citations back to them; see Documents.
+	Documents []Document
+
+	// ExtensionFields adds the native_finish_reason and safety_ratings
+	// extension fields to Claude responses. They are not part of the
+	// Anthropic schema, so clients have to opt in.
+	ExtensionFields bool
 }
 
-var functionCallIDCounter uint64
+// OpenAIStreamError returns an error event for a stream that failed after it
+// started.
+func OpenAIStreamError(message string) string {
+	data, _ := sjson.Set(`{"error":{"type":"api_error","message":""}}`, "error.message", message)
+	return "data: " + data + "\n\n"
+}
 
 // ConvertAntigravityResponseToOpenAI converts a streaming Antigravity response to OpenAI format.
 func ConvertAntigravityResponseToOpenAI(modelName string, rawJSON []byte, state *OpenAIStreamState, opts *TranslatorOptions) []string {
@@ -63,31 +87,32 @@ func ConvertAntigravityResponseToOpenAI(modelName string, rawJSON []byte, state
 		template, _ = sjson.Set(template, "id", responseIDResult.String())
 	}
 
-	// Extract and set the finish reason
-	if finishReasonResult := gjson.GetBytes(rawJSON, "response.candidates.0.finishReason"); finishReasonResult.Exists() {
-		template, _ = sjson.Set(template, "choices.0.finish_reason", strings.ToLower(finishReasonResult.String()))
-		template, _ = sjson.Set(template, "choices.0.native_finish_reason", strings.ToLower(finishReasonResult.String()))
-	}
-
 	// Extract and set usage metadata
 	if usageResult := gjson.GetBytes(rawJSON, "response.usageMetadata"); usageResult.Exists() {
-		if candidatesTokenCountResult := usageResult.Get("candidatesTokenCount"); candidatesTokenCountResult.Exists() {
-			template, _ = sjson.Set(template, "usage.completion_tokens", candidatesTokenCountResult.Int())
-		}
+		// Completion tokens include the reasoning tokens, as in OpenAI usage
+		thoughtsTokenCount := usageResult.Get("thoughtsTokenCount").Int()
+		template, _ = sjson.Set(template, "usage.completion_tokens", usageResult.Get("candidatesTokenCount").Int()+thoughtsTokenCount)
 		if totalTokenCountResult := usageResult.Get("totalTokenCount"); totalTokenCountResult.Exists() {
 			template, _ = sjson.Set(template, "usage.total_tokens", totalTokenCountResult.Int())
 		}
-		promptTokenCount := usageResult.Get("promptTokenCount").Int()
-		thoughtsTokenCount := usageResult.Get("thoughtsTokenCount").Int()
-		template, _ = sjson.Set(template, "usage.prompt_tokens", promptTokenCount+thoughtsTokenCount)
+		template, _ = sjson.Set(template, "usage.prompt_tokens", usageResult.Get("promptTokenCount").Int())
+		if cachedTokenCount := usageResult.Get("cachedContentTokenCount").Int(); cachedTokenCount > 0 {
+			template, _ = sjson.Set(template, "usage.prompt_tokens_details.cached_tokens", cachedTokenCount)
+		}
 		if thoughtsTokenCount > 0 {
 			template, _ = sjson.Set(template, "usage.completion_tokens_details.reasoning_tokens", thoughtsTokenCount)
 		}
 	}
 
+	// Tool call chunks share the chunk's metadata
+	toolChunkTemplate := `{"id":"","object":"chat.completion.chunk","created":0,"model":"","choices":[{"index":0,"delta":{},"finish_reason":null}]}`
+	toolChunkTemplate, _ = sjson.Set(toolChunkTemplate, "id", gjson.Get(template, "id").String())
+	toolChunkTemplate, _ = sjson.Set(toolChunkTemplate, "created", gjson.Get(template, "created").Int())
+	toolChunkTemplate, _ = sjson.Set(toolChunkTemplate, "model", gjson.Get(template, "model").String())
+	var toolChunks []string
+
 	// Process the main content parts
 	partsResult := gjson.GetBytes(rawJSON, "response.candidates.0.content.parts")
-	hasFunctionCall := false
 	if partsResult.IsArray() {
 		partResults := partsResult.Array()
 		for i := 0; i < len(partResults); i++ {
@@ -116,17 +141,22 @@ func ConvertAntigravityResponseToOpenAI(modelName string, rawJSON []byte, state
 
 				// Handle reasoning content vs regular content
 				if partResult.Get("thought").Bool() {
-					if opts.ThinkingAsContent {
+					switch opts.ThinkingOutput {
+					case ThinkingOutputContent:
 						if !state.ThinkingOpen {
 							textContent = "<think>\n" + textContent
 							state.ThinkingOpen = true
 						}
 						template, _ = sjson.Set(template, "choices.0.delta.content", textContent)
-					} else {
+					case ThinkingOutputSummary:
+						template, _ = sjson.SetRaw(template, "choices.0.delta.reasoning_details", reasoningSummaryDetails(textContent))
+					case ThinkingOutputNone:
+						continue
+					default:
 						template, _ = sjson.Set(template, "choices.0.delta.reasoning_content", textContent)
 					}
 				} else {
-					if opts.ThinkingAsContent && state.ThinkingOpen {
+					if state.ThinkingOpen {
 						textContent = "\n</think>\n\n" + textContent
 						state.ThinkingOpen = false
 					}
@@ -134,26 +164,29 @@ func ConvertAntigravityResponseToOpenAI(modelName string, rawJSON []byte, state
 				}
 				template, _ = sjson.Set(template, "choices.0.delta.role", "assistant")
 			} else if functionCallResult.Exists() {
-				hasFunctionCall = true
-				toolCallsResult := gjson.Get(template, "choices.0.delta.tool_calls")
+				// Tool calls follow the chunk in chunks of their own: the call
+				// header, then its arguments in fragments
 				functionCallIndex := state.FunctionIndex
 				state.FunctionIndex++
-				if toolCallsResult.Exists() && toolCallsResult.IsArray() {
-					functionCallIndex = len(toolCallsResult.Array())
-				} else {
-					template, _ = sjson.SetRaw(template, "choices.0.delta.tool_calls", `[]`)
-				}
 
-				functionCallTemplate := `{"id": "","index": 0,"type": "function","function": {"name": "","arguments": ""}}`
-				fcName := functionCallResult.Get("name").String()
-				functionCallTemplate, _ = sjson.Set(functionCallTemplate, "id", fmt.Sprintf("%s-%d-%d", fcName, time.Now().UnixNano(), atomic.AddUint64(&functionCallIDCounter, 1)))
+				fcName := opts.toolName(functionCallResult.Get("name").String())
+				functionCallTemplate := `{"index":0,"id":"","type":"function","function":{"name":"","arguments":""}}`
 				functionCallTemplate, _ = sjson.Set(functionCallTemplate, "index", functionCallIndex)
+				functionCallTemplate, _ = sjson.Set(functionCallTemplate, "id", toolCallID(openAIToolCallIDPrefix, functionCallResult, gjson.GetBytes(rawJSON, "response.responseId").String(), functionCallIndex))
 				functionCallTemplate, _ = sjson.Set(functionCallTemplate, "function.name", fcName)
+				headerChunk, _ := sjson.Set(toolChunkTemplate, "choices.0.delta.role", "assistant")
+				headerChunk, _ = sjson.SetRaw(headerChunk, "choices.0.delta.tool_calls", "["+functionCallTemplate+"]")
+				toolChunks = append(toolChunks, headerChunk)
+
 				if fcArgsResult := functionCallResult.Get("args"); fcArgsResult.Exists() {
-					functionCallTemplate, _ = sjson.Set(functionCallTemplate, "function.arguments", fcArgsResult.Raw)
+					for _, fragment := range splitToolArguments(fcArgsResult.Raw) {
+						argumentsTemplate := `{"index":0,"function":{"arguments":""}}`
+						argumentsTemplate, _ = sjson.Set(argumentsTemplate, "index", functionCallIndex)
+						argumentsTemplate, _ = sjson.Set(argumentsTemplate, "function.arguments", fragment)
+						argumentsChunk, _ := sjson.SetRaw(toolChunkTemplate, "choices.0.delta.tool_calls", "["+argumentsTemplate+"]")
+						toolChunks = append(toolChunks, argumentsChunk)
+					}
 				}
-				template, _ = sjson.Set(template, "choices.0.delta.role", "assistant")
-				template, _ = sjson.SetRaw(template, "choices.0.delta.tool_calls.-1", functionCallTemplate)
 			} else if inlineDataResult.Exists() {
 				data := inlineDataResult.Get("data").String()
 				if data == "" {
@@ -186,12 +219,44 @@ func ConvertAntigravityResponseToOpenAI(modelName string, rawJSON []byte, state
 		}
 	}
 
-	if hasFunctionCall {
-		template, _ = sjson.Set(template, "choices.0.finish_reason", "tool_calls")
-		template, _ = sjson.Set(template, "choices.0.native_finish_reason", "tool_calls")
+	// Set the finish reason once the upstream reports it, keeping the native
+	// reason in native_finish_reason
+	if finishReasonResult := gjson.GetBytes(rawJSON, "response.candidates.0.finishReason"); finishReasonResult.Exists() {
+		template, _ = sjson.Set(template, "choices.0.finish_reason", OpenAIFinishReason(finishReasonResult.String(), state.FunctionIndex > 0))
+		template, _ = sjson.Set(template, "choices.0.native_finish_reason", strings.ToLower(finishReasonResult.String()))
+	}
+	if native, refusal, ok := refusalReason(gjson.GetBytes(rawJSON, "response")); ok {
+		template, _ = sjson.Set(template, "choices.0.delta.role", "assistant")
+		template, _ = sjson.Set(template, "choices.0.delta.refusal", refusal)
+		template, _ = sjson.Set(template, "choices.0.finish_reason", "content_filter")
+		template, _ = sjson.Set(template, "choices.0.native_finish_reason", strings.ToLower(native))
+		if ratings := blockedSafetyRatings(gjson.GetBytes(rawJSON, "response")); ratings != "" {
+			template, _ = sjson.SetRaw(template, "choices.0.safety_ratings", ratings)
+		}
 	}
 
-	return []string{template}
+	if len(toolChunks) == 0 {
+		return []string{template}
+	}
+
+	// The finish reason and usage belong to the last chunk
+	last := len(toolChunks) - 1
+	for _, path := range []string{"choices.0.finish_reason", "choices.0.native_finish_reason", "usage"} {
+		if v := gjson.Get(template, path); v.Exists() && v.Type != gjson.Null {
+			toolChunks[last], _ = sjson.SetRaw(toolChunks[last], path, v.Raw)
+			template, _ = sjson.Set(template, path, nil)
+		}
+	}
+	template, _ = sjson.Delete(template, "usage")
+
+	// Drop the leading chunk when the upstream chunk only carried tool calls
+	delta := gjson.Get(template, "choices.0.delta")
+	for _, field := range []string{"content", "reasoning_content", "reasoning_details", "images", "refusal"} {
+		if v := delta.Get(field); v.Exists() && v.Type != gjson.Null {
+			return append([]string{template}, toolChunks...)
+		}
+	}
+	return toolChunks
 }
 
 // ConvertAntigravityResponseToOpenAINonStream converts a non-streaming response.
@@ -224,9 +289,18 @@ func ConvertAntigravityResponseToOpenAINonStream(modelName string, rawJSON []byt
 		}
 	}
 
-	// Set finish reason
+	// Set finish reason, keeping the native reason in native_finish_reason
 	if v := root.Get("candidates.0.finishReason"); v.Exists() {
-		template, _ = sjson.Set(template, "choices.0.finish_reason", strings.ToLower(v.String()))
+		template, _ = sjson.Set(template, "choices.0.finish_reason", OpenAIFinishReason(v.String(), false))
+		template, _ = sjson.Set(template, "choices.0.native_finish_reason", strings.ToLower(v.String()))
+	}
+	if native, refusal, ok := refusalReason(root); ok {
+		template, _ = sjson.Set(template, "choices.0.message.refusal", refusal)
+		template, _ = sjson.Set(template, "choices.0.finish_reason", "content_filter")
+		template, _ = sjson.Set(template, "choices.0.native_finish_reason", strings.ToLower(native))
+		if ratings := blockedSafetyRatings(root); ratings != "" {
+			template, _ = sjson.SetRaw(template, "choices.0.safety_ratings", ratings)
+		}
 	}
 
 	// Set usage
@@ -237,8 +311,11 @@ func ConvertAntigravityResponseToOpenAINonStream(modelName string, rawJSON []byt
 		totalTokens := usage.Get("totalTokenCount").Int()
 
 		template, _ = sjson.Set(template, "usage.prompt_tokens", promptTokens)
-		template, _ = sjson.Set(template, "usage.completion_tokens", candidatesTokens)
+		template, _ = sjson.Set(template, "usage.completion_tokens", candidatesTokens+thoughtsTokens)
 		template, _ = sjson.Set(template, "usage.total_tokens", totalTokens)
+		if cachedTokens := usage.Get("cachedContentTokenCount").Int(); cachedTokens > 0 {
+			template, _ = sjson.Set(template, "usage.prompt_tokens_details.cached_tokens", cachedTokens)
+		}
 		if thoughtsTokens > 0 {
 			template, _ = sjson.Set(template, "usage.completion_tokens_details.reasoning_tokens", thoughtsTokens)
 		}
@@ -255,9 +332,11 @@ func ConvertAntigravityResponseToOpenAINonStream(modelName string, rawJSON []byt
 		for _, part := range parts.Array() {
 			if text := part.Get("text"); text.Exists() {
 				if part.Get("thought").Bool() {
-					if opts.ThinkingAsContent {
+					switch opts.ThinkingOutput {
+					case ThinkingOutputContent:
 						contentBuilder.WriteString("<think>\n" + text.String() + "\n</think>\n\n")
-					} else {
+					case ThinkingOutputNone:
+					default:
 						reasoningBuilder.WriteString(text.String())
 					}
 				} else {
@@ -268,10 +347,10 @@ func ConvertAntigravityResponseToOpenAINonStream(modelName string, rawJSON []byt
 
 			if fc := part.Get("functionCall"); fc.Exists() {
 				toolCall := map[string]any{
-					"id":   fmt.Sprintf("%s-%d", fc.Get("name").String(), len(toolCalls)),
+					"id":   toolCallID(openAIToolCallIDPrefix, fc, root.Get("responseId").String(), len(toolCalls)),
 					"type": "function",
 					"function": map[string]any{
-						"name":      fc.Get("name").String(),
+						"name":      opts.toolName(fc.Get("name").String()),
 						"arguments": fc.Get("args").Raw,
 					},
 				}
@@ -305,11 +384,15 @@ func ConvertAntigravityResponseToOpenAINonStream(modelName string, rawJSON []byt
 		template, _ = sjson.Set(template, "choices.0.message.content", contentBuilder.String())
 	}
 	if reasoningBuilder.Len() > 0 {
-		template, _ = sjson.Set(template, "choices.0.message.reasoning_content", reasoningBuilder.String())
+		if opts.ThinkingOutput == ThinkingOutputSummary {
+			template, _ = sjson.SetRaw(template, "choices.0.message.reasoning_details", reasoningSummaryDetails(reasoningBuilder.String()))
+		} else {
+			template, _ = sjson.Set(template, "choices.0.message.reasoning_content", reasoningBuilder.String())
+		}
 	}
 	if len(toolCalls) > 0 {
 		template, _ = sjson.Set(template, "choices.0.message.tool_calls", toolCalls)
-		template, _ = sjson.Set(template, "choices.0.finish_reason", "tool_calls")
+		template, _ = sjson.Set(template, "choices.0.finish_reason", OpenAIFinishReason(root.Get("candidates.0.finishReason").String(), true))
 	}
 	if len(images) > 0 {
 		template, _ = sjson.Set(template, "choices.0.message.images", images)
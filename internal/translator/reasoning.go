@@ -0,0 +1,44 @@
+package translator
+
+import (
+	"strings"
+
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// Thinking output modes for OpenAI responses.
+const (
+	// ThinkingOutputReasoning emits thoughts as reasoning_content.
+	ThinkingOutputReasoning = "reasoning_content"
+	// ThinkingOutputContent emits thoughts inline in content, wrapped in <think> tags.
+	ThinkingOutputContent = "content"
+	// ThinkingOutputSummary emits thoughts as reasoning summary items in reasoning_details.
+	ThinkingOutputSummary = "summary"
+	// ThinkingOutputNone drops thoughts from the response.
+	ThinkingOutputNone = "none"
+)
+
+// ResolveThinkingOutput returns the thinking output mode for an OpenAI request.
+// The thinking_output extension field wins, then a requested reasoning summary,
+// then the server default.
+func ResolveThinkingOutput(rawJSON []byte, thinkingAsContent bool) string {
+	switch mode := strings.ToLower(gjson.GetBytes(rawJSON, "thinking_output").String()); mode {
+	case ThinkingOutputReasoning, ThinkingOutputContent, ThinkingOutputSummary, ThinkingOutputNone:
+		return mode
+	}
+	if summary := gjson.GetBytes(rawJSON, "reasoning.summary").String(); summary != "" && summary != "none" {
+		return ThinkingOutputSummary
+	}
+	if thinkingAsContent {
+		return ThinkingOutputContent
+	}
+	return ThinkingOutputReasoning
+}
+
+// reasoningSummaryDetails returns a reasoning_details array holding text as a
+// single reasoning summary item.
+func reasoningSummaryDetails(text string) string {
+	item, _ := sjson.Set(`{"type":"reasoning.summary","summary":"","index":0}`, "summary", text)
+	return "[" + item + "]"
+}
@@ -0,0 +1,149 @@
+package translator
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// responsesContentTypes maps Responses API content part types to their Chat
+// Completions equivalents.
+var responsesContentTypes = map[string]string{
+	"input_text":  "text",
+	"output_text": "text",
+	"input_image": "image_url",
+	"input_file":  "file",
+	"input_audio": "input_audio",
+}
+
+// ResponsesInputToMessages rewrites the instructions and input of a Responses
+// API request as Chat Completions messages, so that it can be handled like a
+// chat request. Requests that already carry messages are returned unchanged.
+// function_call items become assistant tool calls and function_call_output
+// items tool messages. reasoning items are skipped, as thoughts are not sent
+// back upstream. Other item types are rejected.
+func ResponsesInputToMessages(rawJSON []byte) ([]byte, error) {
+	input := gjson.GetBytes(rawJSON, "input")
+	if gjson.GetBytes(rawJSON, "messages").Exists() || !input.Exists() {
+		return rawJSON, nil
+	}
+
+	var messages []string
+	if instructions := gjson.GetBytes(rawJSON, "instructions").String(); instructions != "" {
+		message, _ := sjson.Set(`{"role":"system"}`, "content", instructions)
+		messages = append(messages, message)
+	}
+
+	if input.Type == gjson.String {
+		message, _ := sjson.Set(`{"role":"user"}`, "content", input.String())
+		messages = append(messages, message)
+	}
+	for i, item := range input.Array() {
+		switch itemType := item.Get("type").String(); itemType {
+		case "", "message":
+			messages = append(messages, responsesMessage(item))
+		case "function_call":
+			toolCall := `{"type":"function","function":{}}`
+			toolCall, _ = sjson.Set(toolCall, "id", item.Get("call_id").String())
+			toolCall, _ = sjson.Set(toolCall, "function.name", item.Get("name").String())
+			toolCall, _ = sjson.Set(toolCall, "function.arguments", item.Get("arguments").String())
+
+			// Parallel calls, and calls following the assistant's text, belong
+			// to the same assistant message
+			last := len(messages) - 1
+			if last < 0 || gjson.Get(messages[last], "role").String() != "assistant" {
+				messages = append(messages, `{"role":"assistant","tool_calls":[]}`)
+				last++
+			}
+			messages[last], _ = sjson.SetRaw(messages[last], "tool_calls.-1", toolCall)
+		case "function_call_output":
+			message, _ := sjson.Set(`{"role":"tool"}`, "tool_call_id", item.Get("call_id").String())
+			output := item.Get("output")
+			if output.Type == gjson.String {
+				message, _ = sjson.Set(message, "content", output.String())
+			} else {
+				message, _ = sjson.SetRaw(message, "content", responsesContent(output))
+			}
+			messages = append(messages, message)
+		case "reasoning":
+		default:
+			return nil, fmt.Errorf("input[%d]: unsupported input item type %q", i, itemType)
+		}
+	}
+
+	out, _ := sjson.SetRawBytes(rawJSON, "messages", []byte("["+strings.Join(messages, ",")+"]"))
+	return out, nil
+}
+
+// responsesMessage converts a Responses API message item into a Chat
+// Completions message. Assistant messages carry their text as a string, the
+// form the chat translator reads for the model's turns.
+func responsesMessage(item gjson.Result) string {
+	role := item.Get("role").String()
+	if role == "developer" {
+		role = "system"
+	}
+	message, _ := sjson.Set(`{}`, "role", role)
+
+	content := item.Get("content")
+	switch {
+	case content.Type == gjson.String:
+		message, _ = sjson.Set(message, "content", content.String())
+	case role == "assistant":
+		var text strings.Builder
+		for _, part := range content.Array() {
+			text.WriteString(part.Get("text").String())
+		}
+		message, _ = sjson.Set(message, "content", text.String())
+	default:
+		message, _ = sjson.SetRaw(message, "content", responsesContent(content))
+	}
+	return message
+}
+
+// responsesContent converts an array of Responses API content parts into Chat
+// Completions content parts.
+func responsesContent(content gjson.Result) string {
+	converted := "[]"
+	for _, part := range content.Array() {
+		if convertedPart, ok := responsesContentPart(part); ok {
+			converted, _ = sjson.SetRaw(converted, "-1", convertedPart)
+		}
+	}
+	return converted
+}
+
+// responsesContentPart converts a Responses API content part into a Chat
+// Completions content part.
+func responsesContentPart(part gjson.Result) (string, bool) {
+	partType, ok := responsesContentTypes[part.Get("type").String()]
+	if !ok {
+		return "", false
+	}
+	// Images uploaded through the Files API are resolved like other files
+	if partType == "image_url" && part.Get("file_id").Exists() {
+		partType = "file"
+	}
+	converted, _ := sjson.Set(`{}`, "type", partType)
+	switch partType {
+	case "text":
+		converted, _ = sjson.Set(converted, "text", part.Get("text").String())
+	case "image_url":
+		converted, _ = sjson.Set(converted, "image_url.url", part.Get("image_url").String())
+	case "file":
+		for _, field := range []string{"file_data", "file_id", "filename"} {
+			if value := part.Get(field); value.Exists() {
+				converted, _ = sjson.Set(converted, "file."+field, value.String())
+			}
+		}
+	case "input_audio":
+		audio := part.Get("input_audio")
+		if !audio.IsObject() {
+			return "", false
+		}
+		converted, _ = sjson.SetRaw(converted, "input_audio", audio.Raw)
+	}
+	return converted, true
+}
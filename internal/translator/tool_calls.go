@@ -0,0 +1,86 @@
+package translator
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/tidwall/gjson"
+)
+
+// Prefixes of the tool call IDs handed to clients.
+const (
+	openAIToolCallIDPrefix = "call_"
+	claudeToolUseIDPrefix  = "toolu_"
+)
+
+// toolCallID returns the client-facing ID of an upstream function call: the
+// prefix followed by the upstream call ID. Calls without an upstream ID get
+// one derived from the response ID and the call's index in the response, so
+// that IDs are deterministic and unique across turns.
+func toolCallID(prefix string, functionCall gjson.Result, responseID string, index int) string {
+	id := functionCall.Get("id").String()
+	if id == "" || !isToolCallIDSafe(id) {
+		seed := responseID + ":" + strconv.Itoa(index)
+		if id != "" {
+			seed = id
+		} else if responseID == "" {
+			seed = uuid.NewString()
+		}
+		sum := sha256.Sum256([]byte(seed))
+		id = hex.EncodeToString(sum[:12])
+	}
+	return prefix + id
+}
+
+// upstreamToolCallID returns the upstream function call ID for a client tool
+// call ID by removing the prefix added by toolCallID. Both sides of a call and
+// its result go through it, so client-created IDs stay matched as well.
+func upstreamToolCallID(id string) string {
+	for _, prefix := range []string{openAIToolCallIDPrefix, claudeToolUseIDPrefix} {
+		if trimmed, ok := strings.CutPrefix(id, prefix); ok && trimmed != "" {
+			return trimmed
+		}
+	}
+	return id
+}
+
+// isToolCallIDSafe reports whether id only uses characters that both client
+// formats accept in tool call IDs.
+func isToolCallIDSafe(id string) bool {
+	for _, r := range id {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+// toolArgumentsChunkSize is the size, in bytes, of the argument fragments
+// streamed for a tool call.
+const toolArgumentsChunkSize = 64
+
+// splitToolArguments splits a tool call's arguments JSON into fragments for
+// incremental streaming, without splitting UTF-8 sequences. Concatenating the
+// fragments yields the original arguments.
+func splitToolArguments(arguments string) []string {
+	var fragments []string
+	for len(arguments) > toolArgumentsChunkSize {
+		end := toolArgumentsChunkSize
+		for end > 0 && !utf8.RuneStart(arguments[end]) {
+			end--
+		}
+		if end == 0 {
+			end = toolArgumentsChunkSize
+		}
+		fragments = append(fragments, arguments[:end])
+		arguments = arguments[end:]
+	}
+	if arguments != "" {
+		fragments = append(fragments, arguments)
+	}
+	return fragments
+}
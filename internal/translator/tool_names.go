@@ -0,0 +1,82 @@
+package translator
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+
+	"github.com/tidwall/gjson"
+)
+
+// toolNameMaxLength is the longest function name the upstream accepts.
+const toolNameMaxLength = 64
+
+// sanitizeToolName returns a function name the upstream accepts: letters,
+// digits, underscores and dashes, starting with a letter or underscore, at
+// most toolNameMaxLength bytes. Names that need changes get a suffix hashed
+// from the original name, so distinct names stay distinct. Valid names are
+// returned unchanged.
+func sanitizeToolName(name string) string {
+	var b strings.Builder
+	for i, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r == '_':
+			b.WriteRune(r)
+		case i > 0 && (r >= '0' && r <= '9' || r == '-'):
+			b.WriteRune(r)
+		default:
+			b.WriteByte('_')
+		}
+	}
+	sanitized := b.String()
+	if name != "" && sanitized == name && len(name) <= toolNameMaxLength {
+		return name
+	}
+
+	sum := sha256.Sum256([]byte(name))
+	suffix := "_" + hex.EncodeToString(sum[:4])
+	if len(sanitized) > toolNameMaxLength-len(suffix) {
+		sanitized = sanitized[:toolNameMaxLength-len(suffix)]
+	}
+	return sanitized + suffix
+}
+
+// ToolNames returns the mapping from sanitized to original names for the tools
+// of an OpenAI or Claude request whose names are changed on the way upstream.
+// It covers declared tools and tool calls in the conversation history, and is
+// passed to the response translators in TranslatorOptions.ToolNames.
+func ToolNames(rawJSON []byte) map[string]string {
+	names := map[string]string{}
+	add := func(name string) {
+		if name == "" {
+			return
+		}
+		if sanitized := sanitizeToolName(name); sanitized != name {
+			names[sanitized] = name
+		}
+	}
+
+	for _, tool := range gjson.GetBytes(rawJSON, "tools").Array() {
+		add(tool.Get("function.name").String())
+		add(tool.Get("name").String())
+	}
+	for _, message := range gjson.GetBytes(rawJSON, "messages").Array() {
+		for _, toolCall := range message.Get("tool_calls").Array() {
+			add(toolCall.Get("function.name").String())
+		}
+		for _, content := range message.Get("content").Array() {
+			if content.Get("type").String() == "tool_use" {
+				add(content.Get("name").String())
+			}
+		}
+	}
+	return names
+}
+
+// toolName returns the client name of a function called upstream.
+func (o *TranslatorOptions) toolName(name string) string {
+	if original, ok := o.ToolNames[name]; ok {
+		return original
+	}
+	return name
+}
@@ -0,0 +1,56 @@
+package translator
+
+import (
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// functionResponsePart converts the content of a tool result into a
+// functionResponse part. Text and structured content become the response's
+// result, or its error when isError is set. Images become inlineData parts of
+// the function response, so that screenshot tools can hand images back to the
+// model.
+func functionResponsePart(id, name string, content gjson.Result, isError bool) string {
+	key := "response.result"
+	if isError {
+		key = "response.error"
+	}
+
+	response := `{"response":{}}`
+	if id != "" {
+		response, _ = sjson.Set(response, "id", id)
+	}
+	response, _ = sjson.Set(response, "name", name)
+
+	switch {
+	case content.IsArray():
+		blocks := "[]"
+		count := 0
+		var text gjson.Result
+		for _, block := range content.Array() {
+			if part, ok := imagePart(block); ok {
+				response, _ = sjson.SetRaw(response, "parts.-1", part)
+				continue
+			}
+			blocks, _ = sjson.SetRaw(blocks, "-1", block.Raw)
+			text = block.Get("text")
+			count++
+		}
+		switch {
+		case count == 1 && text.Type == gjson.String:
+			response, _ = sjson.Set(response, key, text.String())
+		case count > 0:
+			response, _ = sjson.SetRaw(response, key, blocks)
+		}
+	case content.Type == gjson.String:
+		response, _ = sjson.Set(response, key, content.String())
+	case content.Exists() && content.Type != gjson.Null:
+		response, _ = sjson.SetRaw(response, key, content.Raw)
+	}
+	if isError && !gjson.Get(response, key).Exists() {
+		response, _ = sjson.Set(response, key, "The tool call failed.")
+	}
+
+	part, _ := sjson.SetRaw(`{}`, "functionResponse", response)
+	return part
+}